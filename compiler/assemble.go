@@ -0,0 +1,775 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The built-in assembler understands the subset of nasm syntax that
+// compileProgram emits and writes a static executable without going
+// through nasm and ld
+
+type asmSection uint
+
+const (
+	sectionText asmSection = iota
+	sectionData
+	sectionBss
+	sectionCount
+)
+
+var sectionNames = map[string]asmSection{
+	".text": sectionText,
+	".data": sectionData,
+	".bss":  sectionBss,
+}
+
+type x86Reg struct {
+	num  byte
+	size int
+	// spl, bpl, sil and dil can only be encoded with a REX prefix
+	needsRex bool
+}
+
+var x86Registers = map[string]x86Reg{
+	"rax": {num: 0, size: 8}, "rcx": {num: 1, size: 8}, "rdx": {num: 2, size: 8}, "rbx": {num: 3, size: 8},
+	"rsp": {num: 4, size: 8}, "rbp": {num: 5, size: 8}, "rsi": {num: 6, size: 8}, "rdi": {num: 7, size: 8},
+	"r8": {num: 8, size: 8}, "r9": {num: 9, size: 8}, "r10": {num: 10, size: 8}, "r11": {num: 11, size: 8},
+	"r12": {num: 12, size: 8}, "r13": {num: 13, size: 8}, "r14": {num: 14, size: 8}, "r15": {num: 15, size: 8},
+	"al": {num: 0, size: 1}, "cl": {num: 1, size: 1}, "dl": {num: 2, size: 1}, "bl": {num: 3, size: 1},
+	"spl": {num: 4, size: 1, needsRex: true}, "bpl": {num: 5, size: 1, needsRex: true},
+	"sil": {num: 6, size: 1, needsRex: true}, "dil": {num: 7, size: 1, needsRex: true},
+	"r8b": {num: 8, size: 1}, "r9b": {num: 9, size: 1}, "r10b": {num: 10, size: 1}, "r11b": {num: 11, size: 1},
+	"r12b": {num: 12, size: 1}, "r13b": {num: 13, size: 1}, "r14b": {num: 14, size: 1}, "r15b": {num: 15, size: 1},
+}
+
+var conditionCodes = map[string]byte{
+	"o": 0x0, "no": 0x1, "b": 0x2, "c": 0x2, "nae": 0x2, "ae": 0x3, "nb": 0x3, "nc": 0x3,
+	"e": 0x4, "z": 0x4, "ne": 0x5, "nz": 0x5, "be": 0x6, "na": 0x6, "a": 0x7, "nbe": 0x7,
+	"s": 0x8, "ns": 0x9, "p": 0xa, "np": 0xb, "l": 0xc, "nge": 0xc, "ge": 0xd, "nl": 0xd,
+	"le": 0xe, "ng": 0xe, "g": 0xf, "nle": 0xf,
+}
+
+var operandSizes = map[string]int{"byte": 1, "word": 2, "dword": 4, "qword": 8}
+
+// asmTerm is a number or a symbol of an expression, `$` is the address
+// of the line the expression is on
+type asmTerm struct {
+	negative bool
+	symbol   string
+	value    int64
+}
+
+type asmExpr []asmTerm
+
+func (e asmExpr) symbolic() bool {
+	for _, term := range e {
+		if term.symbol != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// eval resolves the expression, unknown symbols are an error only when final is set
+func (e asmExpr) eval(a *assembler, here int64) (int64, error) {
+	var sum int64
+	for _, term := range e {
+		v := term.value
+		if term.symbol == "$" {
+			v = here
+		} else if term.symbol != "" {
+			value, found := a.symbols[term.symbol]
+			if !found && a.final {
+				return 0, fmt.Errorf("undefined symbol `%v`", term.symbol)
+			}
+			v = value
+		}
+		if term.negative {
+			v = -v
+		}
+		sum += v
+	}
+	return sum, nil
+}
+
+type operandKind uint
+
+const (
+	operandReg operandKind = iota
+	operandImm
+	operandMem
+)
+
+type asmOperand struct {
+	kind operandKind
+	reg  x86Reg
+	// size of a memory operand in bytes, 0 when it has to come from the other operand
+	size  int
+	base  *x86Reg
+	index *x86Reg
+	expr  asmExpr
+}
+
+// asmItem is a line of the source that takes up space in a section
+type asmItem struct {
+	line     int
+	section  asmSection
+	offset   int64
+	size     int64
+	mnemonic string
+	operands []asmOperand
+	data     []byte
+	// global label the local labels of the line are relative to
+	scope string
+}
+
+type asmEqu struct {
+	line    int
+	name    string
+	expr    asmExpr
+	section asmSection
+	offset  int64
+}
+
+type assembler struct {
+	items   []asmItem
+	equs    []asmEqu
+	labels  map[string]asmSection
+	offsets map[string]int64
+	symbols map[string]int64
+	// section sizes and their load addresses
+	sizes [sectionCount]int64
+	bases [sectionCount]int64
+	final bool
+}
+
+// splitOperands splits on the commas that are not inside a string
+func splitOperands(s string) []string {
+	var operands []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == ',':
+			operands = append(operands, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		operands = append(operands, rest)
+	}
+	return operands
+}
+
+// stripComment removes a `;` comment that is not inside a string
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == ';':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func parseNumber(s string) (int64, bool) {
+	if len(s) == 3 && s[0] == '\'' && s[2] == '\'' {
+		return int64(s[1]), true
+	}
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n, true
+	}
+	if n, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func (a *assembler) qualify(name string, scope string) string {
+	if strings.HasPrefix(name, ".") {
+		return scope + name
+	}
+	return name
+}
+
+func (a *assembler) parseExpr(s string, scope string) (asmExpr, error) {
+	var expr asmExpr
+	negative := false
+	start := 0
+	flush := func(end int) error {
+		term := strings.TrimSpace(s[start:end])
+		if term == "" {
+			return fmt.Errorf("missing term in expression `%v`", s)
+		}
+		if n, ok := parseNumber(term); ok {
+			expr = append(expr, asmTerm{negative: negative, value: n})
+		} else {
+			expr = append(expr, asmTerm{negative: negative, symbol: a.qualify(term, scope)})
+		}
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' && i+2 < len(s) {
+			i += 2
+			continue
+		}
+		if (s[i] == '+' || s[i] == '-') && strings.TrimSpace(s[start:i]) != "" {
+			if err := flush(i); err != nil {
+				return nil, err
+			}
+			negative = s[i] == '-'
+			start = i + 1
+		} else if s[i] == '-' {
+			negative = !negative
+			start = i + 1
+		}
+	}
+	if err := flush(len(s)); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func (a *assembler) parseOperand(s string, scope string) (asmOperand, error) {
+	if reg, ok := x86Registers[s]; ok {
+		return asmOperand{kind: operandReg, reg: reg}, nil
+	}
+	size := 0
+	if word, rest, found := strings.Cut(s, " "); found {
+		if n, ok := operandSizes[word]; ok {
+			size = n
+			s = strings.TrimSpace(rest)
+		}
+	}
+	if !strings.HasPrefix(s, "[") {
+		expr, err := a.parseExpr(s, scope)
+		return asmOperand{kind: operandImm, size: size, expr: expr}, err
+	}
+	if !strings.HasSuffix(s, "]") {
+		return asmOperand{}, fmt.Errorf("unterminated memory operand `%v`", s)
+	}
+	op := asmOperand{kind: operandMem, size: size}
+	expr, err := a.parseExpr(s[1:len(s)-1], scope)
+	if err != nil {
+		return op, err
+	}
+	for _, term := range expr {
+		reg, isReg := x86Registers[term.symbol]
+		switch {
+		case !isReg:
+			op.expr = append(op.expr, term)
+		case term.negative || reg.size != 8:
+			return op, fmt.Errorf("invalid address `%v`", s)
+		case op.base == nil:
+			op.base = &reg
+		case op.index == nil && reg.num != 4:
+			op.index = &reg
+		default:
+			return op, fmt.Errorf("invalid address `%v`", s)
+		}
+	}
+	return op, nil
+}
+
+// parseDb turns the operands of `db` into bytes
+func parseDb(operands []string) ([]byte, error) {
+	var data []byte
+	for _, op := range operands {
+		if len(op) >= 2 && (op[0] == '"' || op[0] == '\'') && op[len(op)-1] == op[0] {
+			data = append(data, op[1:len(op)-1]...)
+			continue
+		}
+		n, ok := parseNumber(op)
+		if !ok || n < -128 || n > 255 {
+			return nil, fmt.Errorf("invalid byte `%v`", op)
+		}
+		data = append(data, byte(n))
+	}
+	return data, nil
+}
+
+func (a *assembler) parse(source string) error {
+	section := sectionText
+	scope := ""
+	for i, text := range strings.Split(source, "\n") {
+		line := i + 1
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" || strings.HasPrefix(text, "%") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch strings.ToLower(fields[0]) {
+		case "bits", "global", "extern":
+			continue
+		case "section":
+			s, found := sectionNames[fields[len(fields)-1]]
+			if !found {
+				return fmt.Errorf("%v: unknown section `%v`", line, fields[len(fields)-1])
+			}
+			section = s
+			continue
+		}
+		if len(fields) >= 3 && fields[1] == "equ" {
+			expr, err := a.parseExpr(strings.Join(fields[2:], " "), scope)
+			if err != nil {
+				return fmt.Errorf("%v: %v", line, err)
+			}
+			a.equs = append(a.equs, asmEqu{line: line, name: fields[0], expr: expr, section: section, offset: a.sizes[section]})
+			continue
+		}
+		if label, rest, found := strings.Cut(text, ":"); found && !strings.ContainsAny(label, " \t\"'[") {
+			if !strings.HasPrefix(label, ".") {
+				scope = label
+			}
+			name := a.qualify(label, scope)
+			if _, defined := a.labels[name]; defined {
+				return fmt.Errorf("%v: label `%v` is already defined", line, name)
+			}
+			a.labels[name] = section
+			a.offsets[name] = a.sizes[section]
+			if text = strings.TrimSpace(rest); text == "" {
+				continue
+			}
+		}
+		mnemonic, rest, _ := strings.Cut(text, " ")
+		mnemonic = strings.ToLower(mnemonic)
+		item := asmItem{line: line, section: section, offset: a.sizes[section], mnemonic: mnemonic, scope: scope}
+		operands := splitOperands(rest)
+		switch mnemonic {
+		case "db":
+			data, err := parseDb(operands)
+			if err != nil {
+				return fmt.Errorf("%v: %v", line, err)
+			}
+			item.data = data
+			item.size = int64(len(data))
+		case "resb", "resq":
+			n, ok := parseNumber(strings.TrimSpace(rest))
+			if !ok {
+				return fmt.Errorf("%v: invalid size `%v`", line, rest)
+			}
+			item.size = n
+			if mnemonic == "resq" {
+				item.size *= 8
+			}
+		default:
+			if section != sectionText {
+				return fmt.Errorf("%v: instruction `%v` outside of .text", line, mnemonic)
+			}
+			for _, s := range operands {
+				op, err := a.parseOperand(s, scope)
+				if err != nil {
+					return fmt.Errorf("%v: %v", line, err)
+				}
+				item.operands = append(item.operands, op)
+			}
+			code, err := a.encode(item, 0)
+			if err != nil {
+				return fmt.Errorf("%v: %v", line, err)
+			}
+			item.size = int64(len(code))
+		}
+		a.sizes[section] += item.size
+		a.items = append(a.items, item)
+	}
+	return nil
+}
+
+func fitsInt8(n int64) bool {
+	return n >= -128 && n <= 127
+}
+
+func fitsInt32(n int64) bool {
+	return n >= -(1<<31) && n < 1<<31
+}
+
+func appendInt32(code []byte, n int64) []byte {
+	return append(code, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+func appendInt64(code []byte, n int64) []byte {
+	return appendInt32(appendInt32(code, n), n>>32)
+}
+
+// modRM encodes an instruction with a ModRM operand, reg is the register
+// or opcode extension of the `reg` field and rm the register or memory operand
+func (a *assembler) modRM(wide bool, opcode []byte, reg byte, regNeedsRex bool, rm asmOperand, here int64) ([]byte, error) {
+	var rex byte
+	if wide {
+		rex |= 0x48
+	}
+	if reg >= 8 {
+		rex |= 0x44
+	}
+	force := regNeedsRex
+	var modrm, sib byte
+	hasSib := false
+	var disp []byte
+	switch rm.kind {
+	case operandReg:
+		if rm.reg.num >= 8 {
+			rex |= 0x41
+		}
+		force = force || rm.reg.needsRex
+		modrm = 0xc0 | (reg&7)<<3 | rm.reg.num&7
+	case operandMem:
+		value, err := rm.expr.eval(a, here)
+		if err != nil {
+			return nil, err
+		}
+		if rm.index != nil && rm.index.num >= 8 {
+			rex |= 0x42
+		}
+		if rm.base != nil && rm.base.num >= 8 {
+			rex |= 0x41
+		}
+		var mod byte
+		switch {
+		case rm.base == nil:
+			// absolute address through a SIB without base and index
+		case rm.expr.symbolic() || !fitsInt8(value):
+			mod = 2
+		case value != 0 || rm.base.num&7 == 5:
+			mod = 1
+		}
+		if !fitsInt32(value) {
+			return nil, fmt.Errorf("displacement %v does not fit in 32 bits", value)
+		}
+		switch mod {
+		case 1:
+			disp = []byte{byte(value)}
+		default:
+			if mod == 2 || rm.base == nil {
+				disp = appendInt32(nil, value)
+			}
+		}
+		switch {
+		case rm.base == nil:
+			index := byte(4)
+			if rm.index != nil {
+				index = rm.index.num & 7
+			}
+			modrm = (reg&7)<<3 | 4
+			sib, hasSib = index<<3|5, true
+		case rm.index != nil || rm.base.num&7 == 4:
+			index := byte(4)
+			if rm.index != nil {
+				index = rm.index.num & 7
+			}
+			modrm = mod<<6 | (reg&7)<<3 | 4
+			sib, hasSib = index<<3|rm.base.num&7, true
+		default:
+			modrm = mod<<6 | (reg&7)<<3 | rm.base.num&7
+		}
+	default:
+		return nil, fmt.Errorf("expected a register or memory operand")
+	}
+	var code []byte
+	if rex != 0 || force {
+		code = append(code, rex|0x40)
+	}
+	code = append(code, opcode...)
+	code = append(code, modrm)
+	if hasSib {
+		code = append(code, sib)
+	}
+	return append(code, disp...), nil
+}
+
+// opcodeReg encodes the instructions that add the register number to the opcode
+func opcodeReg(wide bool, opcode byte, reg x86Reg) []byte {
+	var code []byte
+	rex := byte(0)
+	if wide {
+		rex |= 0x48
+	}
+	if reg.num >= 8 {
+		rex |= 0x41
+	}
+	if rex != 0 || reg.needsRex {
+		code = append(code, rex|0x40)
+	}
+	return append(code, opcode+reg.num&7)
+}
+
+// aluOpcodes are the opcodes of `op r/m, r`, `op r, r/m` and the
+// extension of `op r/m, imm`
+var aluOpcodes = map[string][3]byte{
+	"add": {0x01, 0x03, 0},
+	"or":  {0x09, 0x0b, 1},
+	"and": {0x21, 0x23, 4},
+	"sub": {0x29, 0x2b, 5},
+	"xor": {0x31, 0x33, 6},
+	"cmp": {0x39, 0x3b, 7},
+}
+
+// unaryExtensions are the opcode extensions of the 0xf7 and 0xff groups
+var unaryExtensions = map[string]struct {
+	opcode byte
+	ext    byte
+}{
+	"inc":  {0xff, 0},
+	"dec":  {0xff, 1},
+	"not":  {0xf7, 2},
+	"neg":  {0xf7, 3},
+	"mul":  {0xf7, 4},
+	"div":  {0xf7, 6},
+	"idiv": {0xf7, 7},
+}
+
+// operandSize is the size of the register or memory operands, memory
+// operands without a size take the size of the register they are used with
+func operandSize(ops []asmOperand) int {
+	for _, op := range ops {
+		if op.kind == operandReg {
+			return op.reg.size
+		}
+		if op.kind == operandMem && op.size != 0 {
+			return op.size
+		}
+	}
+	return 0
+}
+
+func (a *assembler) encode(item asmItem, here int64) ([]byte, error) {
+	ops := item.operands
+	kinds := func(want ...operandKind) bool {
+		if len(ops) != len(want) {
+			return false
+		}
+		for i, kind := range want {
+			if ops[i].kind != kind {
+				return false
+			}
+		}
+		return true
+	}
+	imm := func(op asmOperand) (int64, error) {
+		return op.expr.eval(a, here)
+	}
+	// relative jump target, encoded as rel32 so the size does not depend on the distance
+	rel := func(opcode []byte) ([]byte, error) {
+		if !kinds(operandImm) {
+			return nil, fmt.Errorf("`%v` expects a label", item.mnemonic)
+		}
+		target, err := imm(ops[0])
+		if err != nil {
+			return nil, err
+		}
+		end := here + int64(len(opcode)) + 4
+		return appendInt32(append([]byte{}, opcode...), target-end), nil
+	}
+	size := operandSize(ops)
+	wide := size == 8
+	m := item.mnemonic
+
+	switch {
+	case m == "ret" && len(ops) == 0:
+		return []byte{0xc3}, nil
+	case m == "syscall" && len(ops) == 0:
+		return []byte{0x0f, 0x05}, nil
+	case m == "cqo" && len(ops) == 0:
+		return []byte{0x48, 0x99}, nil
+	case m == "jmp" && kinds(operandImm):
+		return rel([]byte{0xe9})
+	case m == "call" && kinds(operandImm):
+		return rel([]byte{0xe8})
+	case (m == "jmp" || m == "call") && len(ops) == 1:
+		ext := byte(4)
+		if m == "call" {
+			ext = 2
+		}
+		return a.modRM(false, []byte{0xff}, ext, false, ops[0], here)
+	case strings.HasPrefix(m, "j"):
+		if cc, ok := conditionCodes[m[1:]]; ok {
+			return rel([]byte{0x0f, 0x80 + cc})
+		}
+	case strings.HasPrefix(m, "set") && len(ops) == 1:
+		if cc, ok := conditionCodes[m[3:]]; ok {
+			return a.modRM(false, []byte{0x0f, 0x90 + cc}, 0, false, ops[0], here)
+		}
+	case m == "push" && kinds(operandReg):
+		return opcodeReg(false, 0x50, ops[0].reg), nil
+	case m == "pop" && kinds(operandReg):
+		return opcodeReg(false, 0x58, ops[0].reg), nil
+	case m == "push" && kinds(operandMem):
+		return a.modRM(false, []byte{0xff}, 6, false, ops[0], here)
+	case m == "pop" && kinds(operandMem):
+		return a.modRM(false, []byte{0x8f}, 0, false, ops[0], here)
+	case m == "push" && kinds(operandImm):
+		n, err := imm(ops[0])
+		if err != nil {
+			return nil, err
+		}
+		if !ops[0].expr.symbolic() && fitsInt8(n) {
+			return []byte{0x6a, byte(n)}, nil
+		}
+		return appendInt32([]byte{0x68}, n), nil
+	case m == "mov" && kinds(operandReg, operandImm):
+		n, err := imm(ops[1])
+		if err != nil {
+			return nil, err
+		}
+		reg := ops[0].reg
+		switch {
+		case reg.size == 1:
+			return append(opcodeReg(false, 0xb0, reg), byte(n)), nil
+		// addresses are below 4GB, so the zero extending 32 bit move is enough for them
+		case ops[1].expr.symbolic() || (n >= 0 && n < 1<<32):
+			return appendInt32(opcodeReg(false, 0xb8, reg), n), nil
+		case fitsInt32(n):
+			code, err := a.modRM(true, []byte{0xc7}, 0, false, ops[0], here)
+			return appendInt32(code, n), err
+		default:
+			return appendInt64(opcodeReg(true, 0xb8, reg), n), nil
+		}
+	case m == "mov" && kinds(operandMem, operandImm):
+		n, err := imm(ops[1])
+		if err != nil {
+			return nil, err
+		}
+		switch ops[0].size {
+		case 1:
+			code, err := a.modRM(false, []byte{0xc6}, 0, false, ops[0], here)
+			return append(code, byte(n)), err
+		case 8:
+			code, err := a.modRM(true, []byte{0xc7}, 0, false, ops[0], here)
+			return appendInt32(code, n), err
+		}
+		return nil, fmt.Errorf("`mov` to memory needs a byte or qword size")
+	case m == "mov" && (kinds(operandReg, operandReg) || kinds(operandMem, operandReg)):
+		opcode := byte(0x89)
+		if size == 1 {
+			opcode = 0x88
+		}
+		return a.modRM(wide, []byte{opcode}, ops[1].reg.num, ops[1].reg.needsRex, ops[0], here)
+	case m == "mov" && kinds(operandReg, operandMem):
+		opcode := byte(0x8b)
+		if size == 1 {
+			opcode = 0x8a
+		}
+		return a.modRM(wide, []byte{opcode}, ops[0].reg.num, ops[0].reg.needsRex, ops[1], here)
+	case m == "movzx" && len(ops) == 2 && ops[0].kind == operandReg:
+		return a.modRM(ops[0].reg.size == 8, []byte{0x0f, 0xb6}, ops[0].reg.num, false, ops[1], here)
+	case m == "lea" && kinds(operandReg, operandMem):
+		return a.modRM(true, []byte{0x8d}, ops[0].reg.num, false, ops[1], here)
+	case m == "imul" && len(ops) == 2 && ops[0].kind == operandReg:
+		return a.modRM(true, []byte{0x0f, 0xaf}, ops[0].reg.num, false, ops[1], here)
+	case m == "test" && len(ops) == 2 && ops[1].kind == operandReg:
+		return a.modRM(wide, []byte{0x85}, ops[1].reg.num, false, ops[0], here)
+	}
+	if alu, ok := aluOpcodes[m]; ok && len(ops) == 2 {
+		switch {
+		case ops[1].kind == operandReg && ops[0].kind != operandImm:
+			return a.modRM(wide, []byte{alu[0]}, ops[1].reg.num, ops[1].reg.needsRex, ops[0], here)
+		case ops[0].kind == operandReg && ops[1].kind == operandMem:
+			return a.modRM(wide, []byte{alu[1]}, ops[0].reg.num, ops[0].reg.needsRex, ops[1], here)
+		case ops[1].kind == operandImm && size == 8:
+			n, err := imm(ops[1])
+			if err != nil {
+				return nil, err
+			}
+			if !ops[1].expr.symbolic() && fitsInt8(n) {
+				code, err := a.modRM(true, []byte{0x83}, alu[2], false, ops[0], here)
+				return append(code, byte(n)), err
+			}
+			if a.final && !fitsInt32(n) {
+				return nil, fmt.Errorf("immediate %v does not fit in 32 bits", n)
+			}
+			code, err := a.modRM(true, []byte{0x81}, alu[2], false, ops[0], here)
+			return appendInt32(code, n), err
+		}
+	}
+	if unary, ok := unaryExtensions[m]; ok && len(ops) == 1 && size == 8 {
+		return a.modRM(true, []byte{unary.opcode}, unary.ext, false, ops[0], here)
+	}
+	return nil, fmt.Errorf("unsupported instruction `%v`", m)
+}
+
+// layout places the sections after the ELF headers and resolves the
+// labels and `equ` constants to addresses
+func (a *assembler) layout() {
+	a.bases[sectionText] = elfBase + elfHeadersSize
+	a.bases[sectionData] = alignUp(a.bases[sectionText]+a.sizes[sectionText], elfPageSize)
+	a.bases[sectionBss] = alignUp(a.bases[sectionData]+a.sizes[sectionData], 8)
+	for name, section := range a.labels {
+		a.symbols[name] = a.bases[section] + a.offsets[name]
+	}
+}
+
+func alignUp(n int64, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+// Assemble assembles the nasm source generated by Compile into a static
+// executable, the errors start with the line of the source
+func Assemble(source string) ([]byte, error) {
+	a := assembler{
+		labels:  make(map[string]asmSection),
+		offsets: make(map[string]int64),
+		symbols: make(map[string]int64),
+	}
+	if err := a.parse(source); err != nil {
+		return nil, err
+	}
+	a.layout()
+	for _, equ := range a.equs {
+		value, err := equ.expr.eval(&a, a.bases[equ.section]+equ.offset)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", equ.line, err)
+		}
+		a.symbols[equ.name] = value
+	}
+	entry, found := a.symbols["_start"]
+	if !found {
+		return nil, fmt.Errorf("missing `_start` label")
+	}
+
+	a.final = true
+	var text, data []byte
+	for _, item := range a.items {
+		switch {
+		case item.section == sectionBss:
+			if item.data != nil {
+				return nil, fmt.Errorf("%v: initialized data in .bss", item.line)
+			}
+		case item.mnemonic == "resb" || item.mnemonic == "resq":
+			return nil, fmt.Errorf("%v: `%v` outside of .bss", item.line, item.mnemonic)
+		case item.section == sectionData:
+			data = append(data, item.data...)
+		case item.data != nil:
+			text = append(text, item.data...)
+		default:
+			code, err := a.encode(item, a.bases[sectionText]+item.offset)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", item.line, err)
+			}
+			assert(int64(len(code)) == item.size, "instruction changed size between the passes of Assemble")
+			text = append(text, code...)
+		}
+	}
+	return writeElf(elfImage{
+		entry:    entry,
+		text:     text,
+		textAddr: a.bases[sectionText],
+		data:     data,
+		dataAddr: a.bases[sectionData],
+		bssAddr:  a.bases[sectionBss],
+		bssSize:  a.sizes[sectionBss],
+	}), nil
+}
@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// readElf decodes the headers of an executable written by Assemble
+func readElf(t *testing.T, exe []byte) (elfHeader, [elfPhdrCount]elfPhdr) {
+	t.Helper()
+	var header elfHeader
+	var phdrs [elfPhdrCount]elfPhdr
+	r := bytes.NewReader(exe)
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &phdrs); err != nil {
+		t.Fatal(err)
+	}
+	return header, phdrs
+}
+
+// assembleText returns the text segment of source assembled after a `_start` label
+func assembleText(t *testing.T, source string) []byte {
+	t.Helper()
+	exe, err := Assemble("_start:\n" + source + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, phdrs := readElf(t, exe)
+	return exe[elfHeadersSize:phdrs[0].Filesz]
+}
+
+func TestAssembleEncodings(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []byte
+	}{
+		// REX.W and the REX.R and REX.B extensions
+		{"mov rax, rbx", []byte{0x48, 0x89, 0xd8}},
+		{"mov r12, rax", []byte{0x49, 0x89, 0xc4}},
+		{"mov rax, r12", []byte{0x4c, 0x89, 0xe0}},
+		{"add r13, r12", []byte{0x4d, 0x01, 0xe5}},
+		{"mov rax, [r12+r13]", []byte{0x4b, 0x8b, 0x04, 0x2c}},
+		{"push rax", []byte{0x50}},
+		{"push r12", []byte{0x41, 0x54}},
+		{"pop r13", []byte{0x41, 0x5d}},
+		{"call r14", []byte{0x41, 0xff, 0xd6}},
+		// byte registers that need an empty REX prefix
+		{"mov al, 1", []byte{0xb0, 0x01}},
+		{"mov sil, 1", []byte{0x40, 0xb6, 0x01}},
+		{"mov byte [rbx], sil", []byte{0x40, 0x88, 0x33}},
+		{"setl r12b", []byte{0x41, 0x0f, 0x9c, 0xc4}},
+		{"movzx r12, al", []byte{0x4c, 0x0f, 0xb6, 0xe0}},
+		// r12 and rsp need a SIB, r13 and rbp a displacement
+		{"mov rax, [r12]", []byte{0x49, 0x8b, 0x04, 0x24}},
+		{"mov rax, [rsp]", []byte{0x48, 0x8b, 0x04, 0x24}},
+		{"mov rax, [r13]", []byte{0x49, 0x8b, 0x45, 0x00}},
+		{"mov rax, [rbp]", []byte{0x48, 0x8b, 0x45, 0x00}},
+		{"inc qword [rsp]", []byte{0x48, 0xff, 0x04, 0x24}},
+		// disp8 and disp32
+		{"mov rax, [rbx-8]", []byte{0x48, 0x8b, 0x43, 0xf8}},
+		{"mov qword [r15+8], r12", []byte{0x4d, 0x89, 0x67, 0x08}},
+		{"mov rax, [r15+200]", []byte{0x49, 0x8b, 0x87, 0xc8, 0x00, 0x00, 0x00}},
+		// imm8 and imm32
+		{"push 5", []byte{0x6a, 0x05}},
+		{"push -128", []byte{0x6a, 0x80}},
+		{"push 1000", []byte{0x68, 0xe8, 0x03, 0x00, 0x00}},
+		{"add rax, 127", []byte{0x48, 0x83, 0xc0, 0x7f}},
+		{"add rax, 128", []byte{0x48, 0x81, 0xc0, 0x80, 0x00, 0x00, 0x00}},
+		{"add rax, -129", []byte{0x48, 0x81, 0xc0, 0x7f, 0xff, 0xff, 0xff}},
+		{"sub rsp, 8", []byte{0x48, 0x83, 0xec, 0x08}},
+		{"mov qword [rsp], 7", []byte{0x48, 0xc7, 0x04, 0x24, 0x07, 0x00, 0x00, 0x00}},
+		// labels are always imm32, as their address is only known after the first pass
+		{"push _start", []byte{0x68, 0xb0, 0x00, 0x40, 0x00}},
+		// mov picks the zero extending, the sign extending or the 64 bit form
+		{"mov rax, 1", []byte{0xb8, 0x01, 0x00, 0x00, 0x00}},
+		{"mov r13, 4294967295", []byte{0x41, 0xbd, 0xff, 0xff, 0xff, 0xff}},
+		{"mov rax, -1", []byte{0x48, 0xc7, 0xc0, 0xff, 0xff, 0xff, 0xff}},
+		{"mov rax, 4294967296", []byte{0x48, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}},
+		// jumps and calls are always rel32, backwards and forwards
+		{"jmp _start", []byte{0xe9, 0xfb, 0xff, 0xff, 0xff}},
+		{"jmp end\nret\nend:", []byte{0xe9, 0x01, 0x00, 0x00, 0x00, 0xc3}},
+		{"je end\nret\nend:", []byte{0x0f, 0x84, 0x01, 0x00, 0x00, 0x00, 0xc3}},
+		{"call end\nret\nend:", []byte{0xe8, 0x01, 0x00, 0x00, 0x00, 0xc3}},
+		{
+			"jmp end\n" + strings.Repeat("push rax\n", 200) + "end:",
+			append([]byte{0xe9, 0xc8, 0x00, 0x00, 0x00}, bytes.Repeat([]byte{0x50}, 200)...),
+		},
+		{"ret", []byte{0xc3}},
+		{"syscall", []byte{0x0f, 0x05}},
+		{"cqo", []byte{0x48, 0x99}},
+	}
+	for _, test := range tests {
+		t.Run(strings.SplitN(test.source, "\n", 2)[0], func(t *testing.T) {
+			if got := assembleText(t, test.source); !bytes.Equal(got, test.want) {
+				t.Errorf("got % x, want % x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"_start:\nadd rax, 4294967296\n", "2: immediate 4294967296 does not fit in 32 bits"},
+		{"_start:\nmov rax, [rbx+4294967296]\n", "2: displacement 4294967296 does not fit in 32 bits"},
+		{"_start:\njmp nowhere\n", "2: undefined symbol `nowhere`"},
+		{"_start:\n_start:\n", "2: label `_start` is already defined"},
+		{"ret\n", "missing `_start` label"},
+		{"section .data\n_start:\nret\n", "3: instruction `ret` outside of .text"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			_, err := Assemble(test.source)
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,812 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exit codes of programs that fail a runtime check
+const (
+	exitCodeAssert         = 3
+	exitCodeDivByZero      = 4
+	exitCodeStackUnderflow = 5
+	exitCodeStackOverflow  = 6
+)
+
+// debugStackLimit is the deepest the data stack may grow in `-debug-stack` builds,
+// well below the default 8MB stack limit of linux
+const debugStackLimit = 4 * 1024 * 1024
+
+// stackArgCount is the number of elements instr pops from the data stack
+func stackArgCount(state *CompileState, instr Instr) uint64 {
+	switch instr.Op {
+	case OpDup, OpDrop, OpPrint, OpRead, OpCall, OpAssert:
+		return 1
+	case OpPlus, OpSub, OpMult, OpDivMod, OpSwap, OpWrite, OpSyscall1,
+		OpGt, OpGe, OpLt, OpLe, OpEq:
+		return 2
+	case OpRot:
+		return 3
+	case OpSyscall3:
+		return 4
+	case OpLet:
+		return instr.Operand
+	case OpCallExtern:
+		return uint64(len(state.externs[instr.Operand].Effect.Ins))
+	}
+	return 0
+}
+
+// compileStackUnderflowCheck checks that there are atleast n elements on
+// the data stack, the ones not cached in registers have to be between the
+// stack base recorded at `_start` and the top of the machine stack
+func compileStackUnderflowCheck(state *CompileState, loc Location, n uint64) string {
+	cached := state.cache.depth()
+	if n <= cached {
+		return ""
+	}
+	id := len(state.RuntimeMsgs)
+	retStr := "; -- Stack Underflow Check --\n" +
+		"mov rax, [stack_base]\n" +
+		"sub rax, rsp\n" +
+		fmt.Sprintf("cmp rax, %v\n", 8*(n-cached)) +
+		fmt.Sprintf("jge stack_ok_%v\n", id) +
+		compileRuntimeError(
+			state,
+			loc,
+			fmt.Sprintf("stack underflow, expected %v element(s)", n),
+			exitCodeStackUnderflow,
+		) +
+		fmt.Sprintf("stack_ok_%v:\n", id)
+	return retStr
+}
+
+// compileStackOverflowCheck checks the depth of the data stack and the
+// return stack, it is emitted where the stacks can grow without bound
+func compileStackOverflowCheck(state *CompileState, loc Location) string {
+	id := len(state.RuntimeMsgs)
+	retStr := "; -- Stack Overflow Check --\n" +
+		"mov rax, [stack_base]\n" +
+		"sub rax, rsp\n" +
+		fmt.Sprintf("cmp rax, %v\n", debugStackLimit) +
+		fmt.Sprintf("jg stack_overflow_%v\n", id) +
+		"mov rax, r15\n" +
+		"sub rax, ret_stack\n" +
+		// leave room for a let frame or a return address to be pushed
+		"cmp rax, 64\n" +
+		fmt.Sprintf("jge stack_ok_%v\n", id) +
+		fmt.Sprintf("stack_overflow_%v:\n", id) +
+		compileRuntimeError(state, loc, "stack overflow", exitCodeStackOverflow) +
+		fmt.Sprintf("stack_ok_%v:\n", id)
+	return retStr
+}
+
+// compileRuntimeError returns the code that reports `msg` at `loc` on stderr
+// and exits with `exitCode`, the message itself is emitted into `.data`
+func compileRuntimeError(state *CompileState, loc Location, msg string, exitCode int) string {
+	id := len(state.RuntimeMsgs)
+	state.RuntimeMsgs = append(state.RuntimeMsgs,
+		fmt.Sprintf("%v:%v:%v: %v\n", loc.FilePath, loc.Line, loc.Col, msg))
+	retStr := fmt.Sprintf("mov rsi, runtime_msg_%v\n", id) +
+		fmt.Sprintf("mov rdx, runtime_msg_%v_len\n", id) +
+		fmt.Sprintf("mov rdi, %v\n", exitCode) +
+		"jmp runtime_error\n"
+	return retStr
+}
+
+// nasmString renders s as operands of `db`, bytes that cannot be
+// put inside a nasm string are written as numbers
+func nasmString(s string) string {
+	var parts []string
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] >= ' ' && s[i] <= '~' && s[i] != '"' {
+			continue
+		}
+		if i > start {
+			parts = append(parts, "\""+s[start:i]+"\"")
+		}
+		if i < len(s) {
+			parts = append(parts, fmt.Sprintf("%v", s[i]))
+		}
+		start = i + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+func compileTokenInt(state *CompileState, instr Instr) string {
+	retStr := "; -- Int Push --\n"
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, %v\n", reg, instr.Operand)
+	state.cache.push(reg)
+
+	return retStr
+}
+
+func compileTokenPlus(state *CompileState) string {
+	retStr := "; -- Plus --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("add %v, %v\n", a, b)
+	state.cache.push(a)
+
+	return retStr
+}
+
+func compileTokenSub(state *CompileState) string {
+	retStr := "; -- Sub --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("sub %v, %v\n", a, b)
+	state.cache.push(a)
+
+	return retStr
+}
+
+func compileTokenMul(state *CompileState) string {
+	retStr := "; -- Mul --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	// the low half of the product is the same for signed and unsigned operands
+	retStr += fmt.Sprintf("imul %v, %v\n", a, b)
+	state.cache.push(a)
+
+	return retStr
+}
+
+func compileTokenDivMod(state *CompileState, instr Instr) string {
+	retStr := "; -- DivMod --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	if state.Checked {
+		id := len(state.RuntimeMsgs)
+		retStr += fmt.Sprintf("cmp %v, 0\n", b) +
+			fmt.Sprintf("jne divmod_ok_%v\n", id) +
+			compileRuntimeError(state, instr.Loc, "division by zero", exitCodeDivByZero) +
+			fmt.Sprintf("divmod_ok_%v:\n", id)
+	}
+	retStr += "xor rdx, rdx\n" +
+		fmt.Sprintf("mov rax, %v\n", a) +
+		fmt.Sprintf("div %v\n", b) +
+		fmt.Sprintf("mov %v, rax\n", a) +
+		fmt.Sprintf("mov %v, rdx\n", b)
+	state.cache.push(a)
+	state.cache.push(b)
+
+	return retStr
+}
+
+func compileTokenPrint(state *CompileState) string {
+	retStr := "; -- Print --\n"
+	a := state.cache.pop(&retStr)
+	state.cache.flush(&retStr)
+	retStr += fmt.Sprintf("mov rdi, %v\n", a) +
+		"call print\n"
+
+	return retStr
+}
+
+func compileTokenSwap(state *CompileState) string {
+	retStr := "; -- Swap --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	state.cache.push(b)
+	state.cache.push(a)
+
+	return retStr
+}
+
+func compileTokenDup(state *CompileState) string {
+	retStr := "; -- Dup --\n"
+	a := state.cache.pop(&retStr)
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, %v\n", reg, a)
+	state.cache.push(a)
+	state.cache.push(reg)
+
+	return retStr
+}
+
+func compileTokenDrop(state *CompileState) string {
+	retStr := "; -- Drop --\n"
+	if state.cache.depth() > 0 {
+		state.cache.pop(&retStr)
+	} else {
+		retStr += "add rsp, 8\n"
+	}
+
+	return retStr
+}
+
+func compileTokenRot(state *CompileState) string {
+	retStr := "; -- Rot --\n"
+	c := state.cache.pop(&retStr)
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	state.cache.push(b)
+	state.cache.push(c)
+	state.cache.push(a)
+
+	return retStr
+}
+
+func compileTokenBool(state *CompileState, instr Instr) string {
+	retStr := "; -- True --\n"
+	if instr.Operand == 0 {
+		retStr = "; -- False --\n"
+	}
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, %v\n", reg, instr.Operand)
+	state.cache.push(reg)
+
+	return retStr
+}
+
+// setCondition is the `setcc` that materialises the result of a comparison
+var setCondition = map[Op]string{
+	OpGt: "setg",
+	OpGe: "setge",
+	OpLt: "setl",
+	OpLe: "setle",
+	OpEq: "sete",
+}
+
+var compareComment = map[Op]string{
+	OpGt: "; -- Gt --\n",
+	OpGe: "; -- Ge --\n",
+	OpLt: "; -- Lt --\n",
+	OpLe: "; -- Le --\n",
+	OpEq: "; -- Eq --\n",
+}
+
+func compileTokenCompare(state *CompileState, instr Instr) string {
+	retStr := compareComment[instr.Op]
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("cmp %v, %v\n", a, b) +
+		fmt.Sprintf("%v al\n", setCondition[instr.Op]) +
+		fmt.Sprintf("movzx %v, al\n", a)
+	state.cache.push(a)
+
+	return retStr
+}
+
+// the syscall intrinsics take their arguments from the machine stack
+func compileTokenSyscall1(state *CompileState) string {
+	retStr := "; -- Syscall1 --\n"
+	state.cache.flush(&retStr)
+	retStr += "pop rax\n" +
+		"pop rdi\n" +
+		"syscall\n" +
+		""
+	return retStr
+}
+
+func compileTokenSyscall3(state *CompileState) string {
+	retStr := "; -- Syscall3 --\n"
+	state.cache.flush(&retStr)
+	retStr += "pop rax\n" +
+		"pop rdi\n" +
+		"pop rsi\n" +
+		"pop rdx\n" +
+		"syscall\n" +
+		""
+	return retStr
+}
+
+// compileTokenExternCall calls a C function with the SysV calling convention,
+// the machine stack is aligned to 16 bytes for the call and restored from rbx,
+// which C functions preserve like r12 to r15
+func compileTokenExternCall(state *CompileState, extern Extern) string {
+	retStr := fmt.Sprintf("; -- Extern Call %v --\n", extern.Name)
+	state.cache.flush(&retStr)
+	for i := len(extern.Effect.Ins) - 1; i >= 0; i-- {
+		retStr += fmt.Sprintf("pop %v\n", cArgRegisters[i])
+	}
+	retStr += "mov [ret_stack_top], r15\n" +
+		"mov rbx, rsp\n" +
+		"and rsp, -16\n" +
+		fmt.Sprintf("call %v\n", extern.Name) +
+		"mov rsp, rbx\n"
+	if len(extern.Effect.Outs) > 0 {
+		reg := state.cache.alloc(&retStr)
+		if extern.Effect.Outs[0].Type == TokenBool {
+			// only the low byte of a C bool is defined
+			retStr += fmt.Sprintf("movzx %v, al\n", reg)
+		} else {
+			retStr += fmt.Sprintf("mov %v, rax\n", reg)
+		}
+		state.cache.push(reg)
+	}
+	return retStr
+}
+
+// compileExport is the C callable entry of an exported quote, it saves the
+// registers C expects to be preserved and runs the quote with its arguments
+// on a data stack that starts at the stack pointer of the caller
+func compileExport(state *CompileState, routine Routine) string {
+	retStr := fmt.Sprintf("; -- Export %v --\n", routine.Export) +
+		fmt.Sprintf("%v:\n", routine.Export) +
+		"push rbx\n" +
+		"push rbp\n" +
+		"push r12\n" +
+		"push r13\n" +
+		"push r14\n" +
+		"push r15\n" +
+		// when called back from a dodo routine that called into C, the frames
+		// of that routine are still in use
+		"mov r15, [ret_stack_top]\n" +
+		"test r15, r15\n" +
+		"jnz .frames\n" +
+		"mov r15, ret_stack_end\n" +
+		".frames:\n"
+	if state.DebugStack {
+		retStr += "push qword [stack_base]\n" +
+			"mov [stack_base], rsp\n"
+	}
+	for i := range routine.Effect.Ins {
+		retStr += fmt.Sprintf("push %v\n", cArgRegisters[i])
+	}
+	retStr += fmt.Sprintf("call %v\n", routine.Name)
+	if len(routine.Effect.Outs) > 0 {
+		retStr += "pop rax\n"
+	}
+	if state.DebugStack {
+		retStr += "pop qword [stack_base]\n"
+	}
+	retStr += "pop r15\n" +
+		"pop r14\n" +
+		"pop r13\n" +
+		"pop r12\n" +
+		"pop rbp\n" +
+		"pop rbx\n" +
+		"ret\n"
+	return retStr
+}
+
+func compileTokenVar(state *CompileState, offset uintptr) string {
+	retStr := "; -- Var --\n"
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, vars_buffer+%v\n", reg, offset)
+	state.cache.push(reg)
+	return retStr
+}
+
+func compileTokenRead(state *CompileState) string {
+	retStr := "; -- Var Read --\n"
+	a := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("mov %v, qword [%v]\n", a, a)
+	state.cache.push(a)
+	return retStr
+}
+
+func compileTokenWrite(state *CompileState) string {
+	retStr := "; -- Var Write --\n"
+	value := state.cache.pop(&retStr)
+	addr := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("mov qword [%v], %v\n", addr, value)
+	return retStr
+}
+
+// let frames live on the return stack next to the return addresses of quotes,
+// the first name is stored at [r15] and the last one is popped first
+func compileTokenLet(state *CompileState, instr Instr) string {
+	retStr := "; -- Let --\n" +
+		fmt.Sprintf("sub r15, %v\n", 8*instr.Operand)
+	for slot := instr.Operand; slot > 0; slot-- {
+		if state.cache.depth() > 0 {
+			retStr += fmt.Sprintf("mov qword [r15+%v], %v\n", 8*(slot-1), state.cache.pop(&retStr))
+		} else {
+			retStr += fmt.Sprintf("pop qword [r15+%v]\n", 8*(slot-1))
+		}
+	}
+	return retStr
+}
+
+func compileTokenLetEnd(instr Instr) string {
+	retStr := "; -- LetEnd --\n" +
+		fmt.Sprintf("add r15, %v\n", 8*instr.Operand) +
+		""
+	return retStr
+}
+
+func compileTokenLocal(state *CompileState, instr Instr) string {
+	retStr := "; -- Local --\n"
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, qword [r15+%v]\n", reg, 8*instr.Operand)
+	state.cache.push(reg)
+	return retStr
+}
+
+func compileTokenAssert(state *CompileState, instr Instr) string {
+	id := len(state.RuntimeMsgs)
+	retStr := "; -- Assert --\n"
+	a := state.cache.pop(&retStr)
+	retStr += fmt.Sprintf("cmp %v, 0\n", a) +
+		fmt.Sprintf("jne assert_ok_%v\n", id) +
+		compileRuntimeError(state, instr.Loc, "assertion failed", exitCodeAssert) +
+		fmt.Sprintf("assert_ok_%v:\n", id) +
+		""
+	return retStr
+}
+
+func compileTokenQuote(state *CompileState, instr Instr) string {
+	retStr := "; -- Quote --\n"
+	reg := state.cache.alloc(&retStr)
+	retStr += fmt.Sprintf("mov %v, quote_%v\n", reg, instr.Operand)
+	state.cache.push(reg)
+	return retStr
+}
+
+// the called quote finds all of its arguments on the machine stack
+func compileTokenCall(state *CompileState) string {
+	retStr := "; -- Call --\n"
+	quote := state.cache.pop(&retStr)
+	state.cache.flush(&retStr)
+	retStr += fmt.Sprintf("call %v\n", quote) +
+		""
+	return retStr
+}
+
+// quotes keep their return address on the return stack pointed to by r15,
+// as the machine stack is the data stack
+func compileQuoteStart(name string) string {
+	retStr := fmt.Sprintf("; -- Quote %v --\n", name) +
+		fmt.Sprintf("%v:\n", name) +
+		"sub r15, 8\n" +
+		"pop qword [r15]\n" +
+		""
+	return retStr
+}
+
+// compileLine maps the code that follows to loc, `nasm -g` puts it into the
+// debug info so that gdb steps through the dodo source instead of the assembly
+func compileLine(loc Location) string {
+	return fmt.Sprintf("%%line %v+0 %v\n", loc.Line, loc.FilePath)
+}
+
+// compileAnnotation names the token at loc that the code that follows was
+// generated from for --annotate, along with the call site of its macro
+func compileAnnotation(state *CompileState, loc Location, site Location) string {
+	if !state.Annotate || loc.FilePath == "" {
+		return ""
+	}
+	retStr := ""
+	if state.AnnotateSource && loc.Line != state.annotatedLine && int(loc.Line) <= len(state.SourceLines) {
+		state.annotatedLine = loc.Line
+		retStr += fmt.Sprintf(";%5v | %v\n", loc.Line, strings.TrimRight(state.SourceLines[loc.Line-1], " \t\r"))
+	}
+	retStr += fmt.Sprintf("; %v:%v:%v  %v", loc.FilePath, loc.Line, loc.Col, state.TokenText[loc])
+	if site != (Location{}) {
+		retStr += fmt.Sprintf("  (macro `%v` expanded at %v:%v:%v)",
+			state.TokenText[site], site.FilePath, site.Line, site.Col)
+	}
+	return retStr + "\n"
+}
+
+func blockLabel(routine Routine, id int) string {
+	return fmt.Sprintf("%v_b%v", routine.Name, id)
+}
+
+func compileTermJump(state *CompileState, routine Routine, target int, next int) string {
+	retStr := ""
+	state.cache.flush(&retStr)
+	if target != next {
+		retStr += "; -- Jump --\n" +
+			fmt.Sprintf("jmp %v\n", blockLabel(routine, target))
+	}
+	return retStr
+}
+
+// compileTermBranch falls through to the next block instead of jumping to it
+func compileTermBranch(state *CompileState, routine Routine, term Term, next int) string {
+	retStr := "; -- Branch --\n"
+	cond := state.cache.pop(&retStr)
+	state.cache.flush(&retStr)
+	state.cache.release()
+	retStr += fmt.Sprintf("cmp %v, 0\n", cond) +
+		fmt.Sprintf("je %v\n", blockLabel(routine, term.Else))
+	if term.Then != next {
+		retStr += fmt.Sprintf("jmp %v\n", blockLabel(routine, term.Then))
+	}
+	return retStr
+}
+
+// invertedJump is the jump taken when the comparison is false
+var invertedJump = map[Op]string{
+	OpGt: "jle",
+	OpGe: "jl",
+	OpLt: "jge",
+	OpLe: "jg",
+	OpEq: "jne",
+}
+
+// compileTermCompareBranch branches on a comparison directly instead of
+// materialising the bool on the stack first
+func compileTermCompareBranch(state *CompileState, routine Routine, term Term, op Op, next int) string {
+	retStr := "; -- Compare Branch --\n"
+	b := state.cache.pop(&retStr)
+	a := state.cache.pop(&retStr)
+	state.cache.flush(&retStr)
+	state.cache.release()
+	retStr += fmt.Sprintf("cmp %v, %v\n", a, b) +
+		fmt.Sprintf("%v %v\n", invertedJump[op], blockLabel(routine, term.Else))
+	if term.Then != next {
+		retStr += fmt.Sprintf("jmp %v\n", blockLabel(routine, term.Then))
+	}
+	return retStr
+}
+
+func compileProgramExit() string {
+	retStr := "; -- Exit --\n" +
+		"mov rax, 60\n" +
+		"mov rdi, 0\n" +
+		"syscall\n"
+	return retStr
+}
+
+func compileQuoteEnd(state *CompileState) string {
+	retStr := "; -- QuoteEnd --\n"
+	state.cache.flush(&retStr)
+	retStr += "push qword [r15]\n" +
+		"add r15, 8\n" +
+		"ret\n" +
+		""
+	return retStr
+}
+
+func compileProgram(program Program, state *CompileState) string {
+	state.externs = program.Externs
+	var sb strings.Builder
+	header := `
+    ; -- Header --
+    BITS 64
+    section .text
+    
+    print_render:
+    xor rbx, rbx
+    mov rcx, 10 
+    .L1:
+    xor rdx, rdx
+    mov rax, rdi
+    div rcx
+    mov rdi, rax
+    add rdx, '0'
+    mov byte [print_buffer + rbx], dl
+    cmp rax, 0
+    je .exit
+    inc rbx
+    jmp .L1
+    .exit:
+    ret
+    print_reverse:
+    xor rdx, rdx
+    mov rcx, 2
+    mov rax, rbx
+    div rcx
+    inc rax
+    mov rsi, rbx
+    xor r9, r9
+    .L1:
+    mov cl, byte [print_buffer + rsi]
+    mov dil, byte [print_buffer + r9]
+    mov byte [print_buffer + rsi], dil
+    mov byte [print_buffer + r9], cl
+    dec rax
+    cmp rax, 0
+    je .exit
+    inc r9
+    dec rsi
+    jmp .L1
+    .exit:
+    inc rbx
+    mov byte [print_buffer + rbx], 10
+    inc rbx
+    ret
+    print:
+    call print_render
+    call print_reverse
+    mov rax, 1
+    mov rdi, 1
+    mov rsi, print_buffer
+    mov rdx, rbx
+    syscall
+    ret
+    runtime_error:
+    mov rbx, rdi
+    mov rax, 1
+    mov rdi, 2
+    syscall
+    mov rax, 60
+    mov rdi, rbx
+    syscall
+
+    global vars_buffer
+    `
+	for _, extern := range program.Externs {
+		header += fmt.Sprintf("extern %v\n", extern.Name)
+	}
+	for _, quote := range program.Quotes {
+		if quote.Export != "" {
+			header += fmt.Sprintf("global %v\n", quote.Export)
+		}
+	}
+	// an object file is linked into a C program, which has its own entry point
+	if !state.Object {
+		header += "global _start\n"
+	}
+	header += "_start:\n" +
+		"mov r15, ret_stack_end\n"
+	if state.DebugStack {
+		header += "mov [stack_base], rsp\n"
+	}
+	sb.WriteString(header)
+	var routines strings.Builder
+	routines.WriteString(compileRoutine(program.Main, state))
+	for _, quote := range program.Quotes {
+		routines.WriteString(compileQuoteStart(quote.Name))
+		if state.DebugStack {
+			routines.WriteString(compileStackOverflowCheck(state, quote.Loc))
+		}
+		routines.WriteString(compileRoutine(quote, state))
+	}
+	code := routines.String()
+	if state.Peephole {
+		code = peephole(code)
+	}
+	sb.WriteString(code)
+	for _, quote := range program.Quotes {
+		if quote.Export != "" {
+			sb.WriteString(compileExport(state, quote))
+		}
+	}
+
+	bss := "section .bss\n" +
+		"print_buffer: resb 22\n" +
+		fmt.Sprintf("vars_buffer: resb %v\n", state.varBufSize) +
+		"ret_stack: resq 1024\n" +
+		"ret_stack_end:\n" +
+		// top of the return stack while C code called with `extern` runs
+		"ret_stack_top: resq 1\n" +
+		"stack_base: resq 1\n"
+
+	sb.WriteString(bss)
+
+	data := "section .data\n"
+	if state.Object {
+		// the stack of a program that links the object does not have to be executable
+		data = "section .note.GNU-stack noalloc noexec nowrite progbits\n" + data
+	}
+	for id, msg := range state.RuntimeMsgs {
+		data += fmt.Sprintf("runtime_msg_%v: db %v\n", id, nasmString(msg)) +
+			fmt.Sprintf("runtime_msg_%v_len equ $ - runtime_msg_%v\n", id, id)
+	}
+	sb.WriteString(data)
+	return sb.String()
+}
+
+func compileRoutine(routine Routine, state *CompileState) string {
+	var sb strings.Builder
+	var lastLoc Location
+	line := func(loc Location) string {
+		// blocks that do not start a loop and the end of a routine have no location
+		if loc.FilePath == "" || loc.Line == lastLoc.Line && loc.FilePath == lastLoc.FilePath {
+			return ""
+		}
+		lastLoc = loc
+		return compileLine(loc)
+	}
+	for _, block := range routine.Blocks {
+		assert(state.cache.depth() == 0, "stack cache not flushed at the end of a block in compileRoutine")
+		fmt.Fprintf(&sb, "%v:\n", blockLabel(routine, block.ID))
+		sb.WriteString(line(block.Loc))
+		if state.DebugStack && block.LoopHead {
+			sb.WriteString(compileStackOverflowCheck(state, block.Loc))
+		}
+		instrs := block.Instrs
+		var fused *Instr
+		if n := len(instrs); block.Term.Kind == TermBranch && n > 0 {
+			if _, isCmp := invertedJump[instrs[n-1].Op]; isCmp {
+				fused = &instrs[n-1]
+				instrs = instrs[:n-1]
+			}
+		}
+		for _, instr := range instrs {
+			sb.WriteString(line(instr.Loc))
+			sb.WriteString(compileAnnotation(state, instr.Loc, instr.Site))
+			if state.DebugStack {
+				if n := stackArgCount(state, instr); n > 0 {
+					sb.WriteString(compileStackUnderflowCheck(state, instr.Loc, n))
+				}
+			}
+			sb.WriteString(compileInstr(instr, state))
+			state.cache.release()
+		}
+		if fused != nil {
+			sb.WriteString(line(fused.Loc))
+			sb.WriteString(compileAnnotation(state, fused.Loc, fused.Site))
+			sb.WriteString(compileAnnotation(state, block.Term.Loc, block.Term.Site))
+			if state.DebugStack {
+				sb.WriteString(compileStackUnderflowCheck(state, fused.Loc, 2))
+			}
+			sb.WriteString(compileTermCompareBranch(state, routine, block.Term, fused.Op, block.ID+1))
+			continue
+		}
+		sb.WriteString(line(block.Term.Loc))
+		sb.WriteString(compileAnnotation(state, block.Term.Loc, block.Term.Site))
+		switch block.Term.Kind {
+		case TermJump:
+			sb.WriteString(compileTermJump(state, routine, block.Term.Then, block.ID+1))
+		case TermBranch:
+			if state.DebugStack {
+				sb.WriteString(compileStackUnderflowCheck(state, block.Term.Loc, 1))
+			}
+			sb.WriteString(compileTermBranch(state, routine, block.Term, block.ID+1))
+		case TermReturn:
+			if routine.Name == "main" {
+				// the program exits with whatever is left on the stack
+				state.cache = stackCache{}
+				sb.WriteString(compileProgramExit())
+			} else {
+				sb.WriteString(compileQuoteEnd(state))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func compileInstr(instr Instr, state *CompileState) string {
+	assert(OpCount == 28, "Exhaustive switch case for compileInstr")
+	switch instr.Op {
+	case OpPushInt:
+		return compileTokenInt(state, instr)
+	case OpPushBool:
+		return compileTokenBool(state, instr)
+	case OpPushVar:
+		return compileTokenVar(state, uintptr(instr.Operand))
+	case OpPushQuote:
+		return compileTokenQuote(state, instr)
+	case OpPlus:
+		return compileTokenPlus(state)
+	case OpSub:
+		return compileTokenSub(state)
+	case OpMult:
+		return compileTokenMul(state)
+	case OpDivMod:
+		return compileTokenDivMod(state, instr)
+	case OpPrint:
+		return compileTokenPrint(state)
+	case OpSwap:
+		return compileTokenSwap(state)
+	case OpDup:
+		return compileTokenDup(state)
+	case OpDrop:
+		return compileTokenDrop(state)
+	case OpRot:
+		return compileTokenRot(state)
+	case OpGt, OpGe, OpLt, OpLe, OpEq:
+		return compileTokenCompare(state, instr)
+	case OpSyscall1:
+		return compileTokenSyscall1(state)
+	case OpSyscall3:
+		return compileTokenSyscall3(state)
+	case OpRead:
+		return compileTokenRead(state)
+	case OpWrite:
+		return compileTokenWrite(state)
+	case OpCall:
+		return compileTokenCall(state)
+	case OpLet:
+		return compileTokenLet(state, instr)
+	case OpLetEnd:
+		return compileTokenLetEnd(instr)
+	case OpLocal:
+		return compileTokenLocal(state, instr)
+	case OpAssert:
+		return compileTokenAssert(state, instr)
+	case OpCallExtern:
+		return compileTokenExternCall(state, state.externs[instr.Operand])
+	}
+	assert(false, "compileInstr unreachable")
+	return ""
+}
@@ -0,0 +1,417 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The arm64 backend emits GNU as syntax for AArch64 linux. The data stack
+// lives in .bss and grows down from data_stack_end with x28 pointing at its
+// top, as sp has to stay 16 byte aligned. x27 is the return stack pointer like
+// r15 on x86-64, and syscall numbers go through syscall_table at runtime as
+// dodo programs use the x86-64 ones
+
+// arm64DataStackSize is the size of the data stack, the same 8MB as the
+// default stack limit of linux that the x86-64 code runs on
+const arm64DataStackSize = 8 * 1024 * 1024
+
+func arm64Push(reg string) string {
+	return fmt.Sprintf("str %v, [x28, #-8]!\n", reg)
+}
+
+func arm64Pop(reg string) string {
+	return fmt.Sprintf("ldr %v, [x28], #8\n", reg)
+}
+
+// arm64LoadImm loads a constant or an address, `ldr =` puts the ones that
+// do not fit a `mov` into the literal pool
+func arm64LoadImm(reg string, value string) string {
+	var n uint64
+	if _, err := fmt.Sscan(value, &n); err == nil && n < 1<<16 {
+		return fmt.Sprintf("mov %v, #%v\n", reg, n)
+	}
+	return fmt.Sprintf("ldr %v, =%v\n", reg, value)
+}
+
+func compileRuntimeErrorArm64(state *CompileState, loc Location, msg string, exitCode int) string {
+	id := len(state.RuntimeMsgs)
+	state.RuntimeMsgs = append(state.RuntimeMsgs,
+		fmt.Sprintf("%v:%v:%v: %v\n", loc.FilePath, loc.Line, loc.Col, msg))
+	retStr := fmt.Sprintf("ldr x1, =runtime_msg_%v\n", id) +
+		fmt.Sprintf("ldr x2, =runtime_msg_%v_len\n", id) +
+		fmt.Sprintf("mov x3, #%v\n", exitCode) +
+		"b runtime_error\n"
+	return retStr
+}
+
+func compileStackUnderflowCheckArm64(state *CompileState, loc Location, n uint64) string {
+	id := len(state.RuntimeMsgs)
+	retStr := "// -- Stack Underflow Check --\n" +
+		"ldr x9, =data_stack_end\n" +
+		"sub x9, x9, x28\n" +
+		fmt.Sprintf("cmp x9, #%v\n", 8*n) +
+		fmt.Sprintf("b.hs stack_ok_%v\n", id) +
+		compileRuntimeErrorArm64(
+			state,
+			loc,
+			fmt.Sprintf("stack underflow, expected %v element(s)", n),
+			exitCodeStackUnderflow,
+		) +
+		fmt.Sprintf("stack_ok_%v:\n", id)
+	return retStr
+}
+
+func compileStackOverflowCheckArm64(state *CompileState, loc Location) string {
+	id := len(state.RuntimeMsgs)
+	retStr := "// -- Stack Overflow Check --\n" +
+		"ldr x9, =data_stack_end\n" +
+		"sub x9, x9, x28\n" +
+		fmt.Sprintf("ldr x10, =%v\n", debugStackLimit) +
+		"cmp x9, x10\n" +
+		fmt.Sprintf("b.hi stack_overflow_%v\n", id) +
+		"ldr x9, =ret_stack\n" +
+		"sub x9, x27, x9\n" +
+		// leave room for a let frame or a return address to be pushed
+		"cmp x9, #64\n" +
+		fmt.Sprintf("b.ge stack_ok_%v\n", id) +
+		fmt.Sprintf("stack_overflow_%v:\n", id) +
+		compileRuntimeErrorArm64(state, loc, "stack overflow", exitCodeStackOverflow) +
+		fmt.Sprintf("stack_ok_%v:\n", id)
+	return retStr
+}
+
+// arm64Conditions are the condition codes of the comparisons, signed like on x86-64
+var arm64Conditions = map[Op]string{
+	OpGt: "gt",
+	OpGe: "ge",
+	OpLt: "lt",
+	OpLe: "le",
+	OpEq: "eq",
+}
+
+// arm64InvertedConditions are the branches taken when the comparison is false
+var arm64InvertedConditions = map[Op]string{
+	OpGt: "le",
+	OpGe: "lt",
+	OpLt: "ge",
+	OpLe: "gt",
+	OpEq: "ne",
+}
+
+var arm64OpNames = map[Op]string{
+	OpPlus: "Plus",
+	OpSub:  "Sub",
+	OpMult: "Mul",
+	OpGt:   "Gt",
+	OpGe:   "Ge",
+	OpLt:   "Lt",
+	OpLe:   "Le",
+	OpEq:   "Eq",
+}
+
+func compileInstrArm64(instr Instr, state *CompileState) string {
+	assert(OpCount == 28, "Exhaustive switch case for compileInstrArm64")
+	switch instr.Op {
+	case OpPushInt:
+		return "// -- Int Push --\n" +
+			arm64LoadImm("x0", fmt.Sprint(instr.Operand)) +
+			arm64Push("x0")
+	case OpPushBool:
+		return "// -- Bool Push --\n" +
+			fmt.Sprintf("mov x0, #%v\n", instr.Operand) +
+			arm64Push("x0")
+	case OpPushVar:
+		return "// -- Var --\n" +
+			fmt.Sprintf("ldr x0, =vars_buffer+%v\n", instr.Operand) +
+			arm64Push("x0")
+	case OpPushQuote:
+		return "// -- Quote --\n" +
+			fmt.Sprintf("ldr x0, =quote_%v\n", instr.Operand) +
+			arm64Push("x0")
+	case OpPlus, OpSub, OpMult:
+		mnemonic := map[Op]string{OpPlus: "add", OpSub: "sub", OpMult: "mul"}[instr.Op]
+		return fmt.Sprintf("// -- %v --\n", arm64OpNames[instr.Op]) +
+			arm64Pop("x1") +
+			arm64Pop("x0") +
+			fmt.Sprintf("%v x0, x0, x1\n", mnemonic) +
+			arm64Push("x0")
+	case OpDivMod:
+		retStr := "// -- DivMod --\n" +
+			arm64Pop("x1") +
+			arm64Pop("x0")
+		if state.Checked {
+			id := len(state.RuntimeMsgs)
+			retStr += fmt.Sprintf("cbnz x1, divmod_ok_%v\n", id) +
+				compileRuntimeErrorArm64(state, instr.Loc, "division by zero", exitCodeDivByZero) +
+				fmt.Sprintf("divmod_ok_%v:\n", id)
+		}
+		return retStr +
+			"udiv x2, x0, x1\n" +
+			"msub x3, x2, x1, x0\n" +
+			arm64Push("x2") +
+			arm64Push("x3")
+	case OpPrint:
+		return "// -- Print --\n" +
+			arm64Pop("x0") +
+			"bl print\n"
+	case OpSwap:
+		return "// -- Swap --\n" +
+			arm64Pop("x1") +
+			arm64Pop("x0") +
+			arm64Push("x1") +
+			arm64Push("x0")
+	case OpDup:
+		return "// -- Dup --\n" +
+			"ldr x0, [x28]\n" +
+			arm64Push("x0")
+	case OpDrop:
+		return "// -- Drop --\n" +
+			"add x28, x28, #8\n"
+	case OpRot:
+		return "// -- Rot --\n" +
+			arm64Pop("x2") +
+			arm64Pop("x1") +
+			arm64Pop("x0") +
+			arm64Push("x1") +
+			arm64Push("x2") +
+			arm64Push("x0")
+	case OpGt, OpGe, OpLt, OpLe, OpEq:
+		return fmt.Sprintf("// -- %v --\n", arm64OpNames[instr.Op]) +
+			arm64Pop("x1") +
+			arm64Pop("x0") +
+			"cmp x0, x1\n" +
+			fmt.Sprintf("cset x0, %v\n", arm64Conditions[instr.Op]) +
+			arm64Push("x0")
+	case OpSyscall1:
+		return "// -- Syscall1 --\n" +
+			arm64Pop("x8") +
+			arm64Pop("x0") +
+			"bl syscall_number\n" +
+			"svc #0\n"
+	case OpSyscall3:
+		return "// -- Syscall3 --\n" +
+			arm64Pop("x8") +
+			arm64Pop("x0") +
+			arm64Pop("x1") +
+			arm64Pop("x2") +
+			"bl syscall_number\n" +
+			"svc #0\n"
+	case OpRead:
+		return "// -- Var Read --\n" +
+			arm64Pop("x0") +
+			"ldr x0, [x0]\n" +
+			arm64Push("x0")
+	case OpWrite:
+		return "// -- Var Write --\n" +
+			arm64Pop("x0") +
+			arm64Pop("x1") +
+			"str x0, [x1]\n"
+	case OpCall:
+		return "// -- Call --\n" +
+			arm64Pop("x0") +
+			"blr x0\n"
+	case OpLet:
+		retStr := "// -- Let --\n" +
+			fmt.Sprintf("sub x27, x27, #%v\n", 8*instr.Operand)
+		for slot := instr.Operand; slot > 0; slot-- {
+			retStr += arm64Pop("x0") +
+				fmt.Sprintf("str x0, [x27, #%v]\n", 8*(slot-1))
+		}
+		return retStr
+	case OpLetEnd:
+		return "// -- LetEnd --\n" +
+			fmt.Sprintf("add x27, x27, #%v\n", 8*instr.Operand)
+	case OpLocal:
+		return "// -- Local --\n" +
+			fmt.Sprintf("ldr x0, [x27, #%v]\n", 8*instr.Operand) +
+			arm64Push("x0")
+	case OpAssert:
+		id := len(state.RuntimeMsgs)
+		return "// -- Assert --\n" +
+			arm64Pop("x0") +
+			fmt.Sprintf("cbnz x0, assert_ok_%v\n", id) +
+			compileRuntimeErrorArm64(state, instr.Loc, "assertion failed", exitCodeAssert) +
+			fmt.Sprintf("assert_ok_%v:\n", id)
+	case OpCallExtern:
+		assert(false, "`extern` is rejected for this backend before compileInstrArm64")
+	}
+	assert(false, "compileInstrArm64 unreachable")
+	return ""
+}
+
+func compileRoutineArm64(routine Routine, state *CompileState) string {
+	var sb strings.Builder
+	for _, block := range routine.Blocks {
+		fmt.Fprintf(&sb, "%v:\n", blockLabel(routine, block.ID))
+		if state.DebugStack && block.LoopHead {
+			sb.WriteString(compileStackOverflowCheckArm64(state, block.Loc))
+		}
+		instrs := block.Instrs
+		var fused *Instr
+		if n := len(instrs); block.Term.Kind == TermBranch && n > 0 {
+			if _, isCmp := arm64InvertedConditions[instrs[n-1].Op]; isCmp {
+				fused = &instrs[n-1]
+				instrs = instrs[:n-1]
+			}
+		}
+		for _, instr := range instrs {
+			if n := stackArgCount(state, instr); state.DebugStack && n > 0 {
+				sb.WriteString(compileStackUnderflowCheckArm64(state, instr.Loc, n))
+			}
+			sb.WriteString(compileInstrArm64(instr, state))
+		}
+		term := block.Term
+		switch {
+		case fused != nil:
+			if state.DebugStack {
+				sb.WriteString(compileStackUnderflowCheckArm64(state, fused.Loc, 2))
+			}
+			sb.WriteString("// -- Compare Branch --\n" +
+				arm64Pop("x1") +
+				arm64Pop("x0") +
+				"cmp x0, x1\n" +
+				fmt.Sprintf("b.%v %v\n", arm64InvertedConditions[fused.Op], blockLabel(routine, term.Else)))
+		case term.Kind == TermBranch:
+			if state.DebugStack {
+				sb.WriteString(compileStackUnderflowCheckArm64(state, term.Loc, 1))
+			}
+			sb.WriteString("// -- Branch --\n" +
+				arm64Pop("x0") +
+				fmt.Sprintf("cbz x0, %v\n", blockLabel(routine, term.Else)))
+		}
+		switch term.Kind {
+		case TermJump:
+			if term.Then != block.ID+1 {
+				sb.WriteString("// -- Jump --\n" +
+					fmt.Sprintf("b %v\n", blockLabel(routine, term.Then)))
+			}
+		case TermBranch:
+			if term.Then != block.ID+1 {
+				fmt.Fprintf(&sb, "b %v\n", blockLabel(routine, term.Then))
+			}
+		case TermReturn:
+			if routine.Name == "main" {
+				sb.WriteString("// -- Exit --\n" +
+					"mov x8, #93\n" +
+					"mov x0, #0\n" +
+					"svc #0\n")
+			} else {
+				sb.WriteString("// -- QuoteEnd --\n" +
+					"ldr x30, [x27], #8\n" +
+					"ret\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// arm64SyscallTableLen is the number of entries of syscall_table, one
+// past the highest x86-64 syscall number that is mapped
+var arm64SyscallTableLen = linuxSyscalls[len(linuxSyscalls)-1].Number + 1
+
+// compileSyscallTableArm64 maps the x86-64 syscall numbers to the arm64 ones,
+// numbers without an arm64 syscall become -1 which fails with ENOSYS
+func compileSyscallTableArm64() string {
+	table := make([]int64, arm64SyscallTableLen)
+	for i := range table {
+		table[i] = -1
+	}
+	for _, syscall := range linuxSyscalls {
+		table[syscall.Number] = syscall.Arm64
+	}
+	var sb strings.Builder
+	sb.WriteString(".balign 2\nsyscall_table:\n")
+	for i := 0; i < len(table); i += 16 {
+		var row []string
+		for _, n := range table[i:min(i+16, len(table))] {
+			row = append(row, fmt.Sprint(n))
+		}
+		fmt.Fprintf(&sb, ".hword %v\n", strings.Join(row, ", "))
+	}
+	return sb.String()
+}
+
+func compileProgramArm64(program Program, state *CompileState) string {
+	header := `// -- Header --
+.text
+
+// print writes x0 as a decimal number and a newline to stdout
+print:
+ldr x1, =print_buffer+21
+mov x2, #10
+strb w2, [x1]
+mov x3, #1
+print_digit:
+udiv x4, x0, x2
+msub x5, x4, x2, x0
+add x5, x5, #48
+sub x1, x1, #1
+strb w5, [x1]
+add x3, x3, #1
+mov x0, x4
+cbnz x0, print_digit
+mov x0, #1
+mov x2, x3
+mov x8, #64
+svc #0
+ret
+
+// syscall_number maps the x86-64 syscall number in x8 to the arm64 one
+syscall_number:
+cmp x8, #%v
+b.hs syscall_unknown
+ldr x9, =syscall_table
+ldrsh x8, [x9, x8, lsl #1]
+ret
+syscall_unknown:
+mov x8, #-1
+ret
+
+// runtime_error writes the message at x1 with length x2 to stderr and exits with x3
+runtime_error:
+mov x0, #2
+mov x8, #64
+svc #0
+mov x0, x3
+mov x8, #93
+svc #0
+
+.global _start
+.global vars_buffer
+_start:
+ldr x28, =data_stack_end
+ldr x27, =ret_stack_end
+`
+	var sb strings.Builder
+	fmt.Fprintf(&sb, header, arm64SyscallTableLen)
+	sb.WriteString(compileRoutineArm64(program.Main, state))
+	for _, quote := range program.Quotes {
+		fmt.Fprintf(&sb, "// -- Quote %v --\n", quote.Name)
+		fmt.Fprintf(&sb, "%v:\n", quote.Name)
+		sb.WriteString("str x30, [x27, #-8]!\n")
+		if state.DebugStack {
+			sb.WriteString(compileStackOverflowCheckArm64(state, quote.Loc))
+		}
+		sb.WriteString(compileRoutineArm64(quote, state))
+	}
+	sb.WriteString(".ltorg\n")
+
+	sb.WriteString(".bss\n" +
+		".balign 8\n" +
+		"print_buffer: .skip 22\n" +
+		".balign 8\n" +
+		fmt.Sprintf("vars_buffer: .skip %v\n", state.varBufSize) +
+		"ret_stack: .skip 8*1024\n" +
+		"ret_stack_end:\n" +
+		fmt.Sprintf("data_stack: .skip %v\n", arm64DataStackSize) +
+		"data_stack_end:\n")
+
+	sb.WriteString(".data\n")
+	sb.WriteString(compileSyscallTableArm64())
+	for id, msg := range state.RuntimeMsgs {
+		fmt.Fprintf(&sb, "runtime_msg_%v: .ascii %v\n", id, cString(msg))
+		fmt.Fprintf(&sb, "runtime_msg_%v_len = . - runtime_msg_%v\n", id, id)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,332 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The C backend translates the IR into a C file that behaves like the
+// assembly of compileProgram, the data stack is an array that grows upwards
+// and every routine is a function that uses goto between its blocks
+
+// cStackCapacity is the number of elements of the data stack, the same
+// 8MB as the default stack limit of linux that the assembly runs on
+const cStackCapacity = 8 * 1024 * 1024 / 8
+
+// cString renders s as a C string literal
+func cString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("\"")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteString("\\" + string(c))
+		case c == '\n':
+			sb.WriteString("\\n")
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString("\"")
+	return sb.String()
+}
+
+func cRuntimeMsg(loc Location, msg string) string {
+	return cString(fmt.Sprintf("%v:%v:%v: %v\n", loc.FilePath, loc.Line, loc.Col, msg))
+}
+
+func cRoutineName(routine Routine) string {
+	return "dodo_" + routine.Name
+}
+
+func compileInstrC(instr Instr, state *CompileState) string {
+	assert(OpCount == 28, "Exhaustive switch case for compileInstrC")
+	switch instr.Op {
+	case OpPushInt:
+		return fmt.Sprintf("push(%vull);\n", instr.Operand)
+	case OpPushBool:
+		return fmt.Sprintf("push(%v);\n", instr.Operand)
+	case OpPushVar:
+		return fmt.Sprintf("push((uint64_t)(uintptr_t)((char *)vars_buffer + %v));\n", instr.Operand)
+	case OpPushQuote:
+		return fmt.Sprintf("push((uint64_t)(uintptr_t)&dodo_quote_%v);\n", instr.Operand)
+	case OpPlus:
+		return "{ uint64_t b = pop(); uint64_t a = pop(); push(a + b); }\n"
+	case OpSub:
+		return "{ uint64_t b = pop(); uint64_t a = pop(); push(a - b); }\n"
+	case OpMult:
+		return "{ uint64_t b = pop(); uint64_t a = pop(); push(a * b); }\n"
+	case OpDivMod:
+		retStr := "{ uint64_t b = pop(); uint64_t a = pop(); "
+		if state.Checked {
+			retStr += fmt.Sprintf("if (b == 0) runtime_error(%v, %v); ",
+				cRuntimeMsg(instr.Loc, "division by zero"), exitCodeDivByZero)
+		}
+		return retStr + "push(a / b); push(a % b); }\n"
+	case OpPrint:
+		return "print(pop());\n"
+	case OpSwap:
+		return "{ uint64_t b = pop(); uint64_t a = pop(); push(b); push(a); }\n"
+	case OpDup:
+		return "{ uint64_t a = pop(); push(a); push(a); }\n"
+	case OpDrop:
+		return "pop();\n"
+	case OpRot:
+		return "{ uint64_t c = pop(); uint64_t b = pop(); uint64_t a = pop(); push(b); push(c); push(a); }\n"
+	case OpGt:
+		return "{ int64_t b = pop(); int64_t a = pop(); push(a > b); }\n"
+	case OpGe:
+		return "{ int64_t b = pop(); int64_t a = pop(); push(a >= b); }\n"
+	case OpLt:
+		return "{ int64_t b = pop(); int64_t a = pop(); push(a < b); }\n"
+	case OpLe:
+		return "{ int64_t b = pop(); int64_t a = pop(); push(a <= b); }\n"
+	case OpEq:
+		return "{ uint64_t b = pop(); uint64_t a = pop(); push(a == b); }\n"
+	case OpSyscall1:
+		return "{ uint64_t n = pop(); uint64_t a1 = pop(); dodo_syscall(n, a1, 0, 0); }\n"
+	case OpSyscall3:
+		return "{ uint64_t n = pop(); uint64_t a1 = pop(); uint64_t a2 = pop(); uint64_t a3 = pop(); dodo_syscall(n, a1, a2, a3); }\n"
+	case OpRead:
+		return "push(*(uint64_t *)(uintptr_t)pop());\n"
+	case OpWrite:
+		return "{ uint64_t value = pop(); uint64_t *addr = (uint64_t *)(uintptr_t)pop(); *addr = value; }\n"
+	case OpCall:
+		return "((void (*)(void))(uintptr_t)pop())();\n"
+	case OpLet:
+		retStr := fmt.Sprintf("rp -= %v;", instr.Operand)
+		for slot := instr.Operand; slot > 0; slot-- {
+			retStr += fmt.Sprintf(" rp[%v] = pop();", slot-1)
+		}
+		return retStr + "\n"
+	case OpLetEnd:
+		return fmt.Sprintf("rp += %v;\n", instr.Operand)
+	case OpLocal:
+		return fmt.Sprintf("push(rp[%v]);\n", instr.Operand)
+	case OpAssert:
+		return fmt.Sprintf("if (!pop()) runtime_error(%v, %v);\n",
+			cRuntimeMsg(instr.Loc, "assertion failed"), exitCodeAssert)
+	case OpCallExtern:
+		extern := state.externs[instr.Operand]
+		retStr := "{ "
+		var args []string
+		for i := len(extern.Effect.Ins) - 1; i >= 0; i-- {
+			retStr += fmt.Sprintf("uint64_t a%v = pop(); ", i)
+		}
+		for i := range extern.Effect.Ins {
+			args = append(args, fmt.Sprintf("a%v", i))
+		}
+		call := fmt.Sprintf("dodo_extern_%v(%v)", extern.Name, strings.Join(args, ", "))
+		if len(extern.Effect.Outs) > 0 {
+			return retStr + fmt.Sprintf("push(%v); }\n", call)
+		}
+		return retStr + call + "; }\n"
+	}
+	assert(false, "compileInstrC unreachable")
+	return ""
+}
+
+func compileRoutineC(routine Routine, state *CompileState) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "static void %v(void) {\n", cRoutineName(routine))
+	if state.DebugStack && routine.Name != "main" {
+		fmt.Fprintf(&sb, "    check_overflow(%v);\n", cRuntimeMsg(routine.Loc, "stack overflow"))
+	}
+	// only the targets of jumps get a label, the entry is never one
+	targets := make(map[int]bool)
+	for _, block := range routine.Blocks {
+		switch block.Term.Kind {
+		case TermJump:
+			targets[block.Term.Then] = true
+		case TermBranch:
+			targets[block.Term.Then] = true
+			targets[block.Term.Else] = true
+		}
+	}
+	for _, block := range routine.Blocks {
+		if targets[block.ID] {
+			fmt.Fprintf(&sb, "b%v:;\n", block.ID)
+		}
+		if state.DebugStack && block.LoopHead {
+			fmt.Fprintf(&sb, "    check_overflow(%v);\n", cRuntimeMsg(block.Loc, "stack overflow"))
+		}
+		for _, instr := range block.Instrs {
+			if n := stackArgCount(state, instr); state.DebugStack && n > 0 {
+				fmt.Fprintf(&sb, "    check_underflow(%v, %v);\n", n,
+					cRuntimeMsg(instr.Loc, fmt.Sprintf("stack underflow, expected %v element(s)", n)))
+			}
+			sb.WriteString("    " + compileInstrC(instr, state))
+		}
+		switch block.Term.Kind {
+		case TermJump:
+			fmt.Fprintf(&sb, "    goto b%v;\n", block.Term.Then)
+		case TermBranch:
+			if state.DebugStack {
+				fmt.Fprintf(&sb, "    check_underflow(1, %v);\n",
+					cRuntimeMsg(block.Term.Loc, "stack underflow, expected 1 element(s)"))
+			}
+			fmt.Fprintf(&sb, "    if (pop()) goto b%v; else goto b%v;\n", block.Term.Then, block.Term.Else)
+		case TermReturn:
+			sb.WriteString("    return;\n")
+		}
+	}
+	sb.WriteString("}\n\n")
+	return sb.String()
+}
+
+// compileSyscallC maps the x86-64 syscall numbers used by dodo programs to
+// the ones of the host, numbers that are not known are passed through
+func compileSyscallC() string {
+	var sb strings.Builder
+	sb.WriteString("static long dodo_syscall_number(uint64_t n) {\n" +
+		"#if defined(__x86_64__)\n" +
+		"    return (long)n;\n" +
+		"#else\n" +
+		"    switch (n) {\n")
+	for _, syscall := range linuxSyscalls {
+		fmt.Fprintf(&sb, "#ifdef SYS_%v\n    case %v: return SYS_%v;\n#endif\n",
+			syscall.Name, syscall.Number, syscall.Name)
+	}
+	sb.WriteString("    }\n" +
+		"    return (long)n;\n" +
+		"#endif\n" +
+		"}\n\n" +
+		"static inline void dodo_syscall(uint64_t n, uint64_t a1, uint64_t a2, uint64_t a3) {\n" +
+		"    syscall(dodo_syscall_number(n), a1, a2, a3);\n" +
+		"}\n\n")
+	return sb.String()
+}
+
+// cType is the C type of a value of the data stack passed to or returned from C
+func cType(info TypeInfo) string {
+	if info.Type == TokenBool {
+		return "_Bool"
+	}
+	return "uint64_t"
+}
+
+// cSignature renders the return type and the parameters of a C function with effect
+func cSignature(effect StackEffect) (string, string) {
+	ret := "void"
+	if len(effect.Outs) > 0 {
+		ret = cType(effect.Outs[0])
+	}
+	var params []string
+	for i, in := range effect.Ins {
+		params = append(params, fmt.Sprintf("%v a%v", cType(in), i))
+	}
+	if len(params) == 0 {
+		return ret, "void"
+	}
+	return ret, strings.Join(params, ", ")
+}
+
+// compileExternsC declares the `extern` functions under their assembly name,
+// so that they do not clash with the declarations of the included headers
+func compileExternsC(program Program) string {
+	var sb strings.Builder
+	for _, extern := range program.Externs {
+		ret, params := cSignature(extern.Effect)
+		fmt.Fprintf(&sb, "extern %v dodo_extern_%v(%v) __asm__(%v);\n", ret, extern.Name, params, cString(extern.Name))
+	}
+	return sb.String()
+}
+
+func compileExportC(routine Routine) string {
+	var sb strings.Builder
+	ret, params := cSignature(routine.Effect)
+	fmt.Fprintf(&sb, "%v %v(%v) {\n", ret, routine.Export, params)
+	for i := range routine.Effect.Ins {
+		fmt.Fprintf(&sb, "    push(a%v);\n", i)
+	}
+	fmt.Fprintf(&sb, "    %v();\n", cRoutineName(routine))
+	if len(routine.Effect.Outs) > 0 {
+		sb.WriteString("    return pop();\n")
+	}
+	sb.WriteString("}\n\n")
+	return sb.String()
+}
+
+func compileVarsBufferC(state *CompileState) string {
+	if state.varBufSize == 0 {
+		return "\n"
+	}
+	return fmt.Sprintf("static uint64_t vars_buffer[%v];\n\n", state.varBufSize/8)
+}
+
+func compileProgramC(program Program, state *CompileState) string {
+	state.externs = program.Externs
+	header := "// generated by dodolang\n" +
+		"#define _GNU_SOURCE\n" +
+		"#include <stdint.h>\n" +
+		"#include <stdlib.h>\n" +
+		"#include <string.h>\n" +
+		"#include <unistd.h>\n" +
+		"#include <sys/syscall.h>\n\n" +
+		fmt.Sprintf("static uint64_t stack[%v];\n", cStackCapacity) +
+		"static uint64_t *sp = stack;\n" +
+		// let frames, quotes return through the C call stack
+		"static uint64_t ret_stack[1024];\n" +
+		"static uint64_t *rp = ret_stack + 1024;\n" +
+		compileVarsBufferC(state) +
+		"static inline void push(uint64_t v) { *sp++ = v; }\n" +
+		"static inline uint64_t pop(void) { return *--sp; }\n\n" +
+		"static inline void runtime_error(const char *msg, int code) {\n" +
+		"    write(2, msg, strlen(msg));\n" +
+		"    _exit(code);\n" +
+		"}\n\n" +
+		"static inline void check_underflow(uint64_t n, const char *msg) {\n" +
+		fmt.Sprintf("    if ((uint64_t)(sp - stack) < n) runtime_error(msg, %v);\n", exitCodeStackUnderflow) +
+		"}\n\n" +
+		"static inline void check_overflow(const char *msg) {\n" +
+		fmt.Sprintf("    if (sp - stack > %v || rp - ret_stack < 8) runtime_error(msg, %v);\n",
+			debugStackLimit/8, exitCodeStackOverflow) +
+		"}\n\n" +
+		"static inline void print(uint64_t v) {\n" +
+		"    char buf[21];\n" +
+		"    int i = sizeof(buf);\n" +
+		"    buf[--i] = '\\n';\n" +
+		"    do {\n" +
+		"        buf[--i] = '0' + v % 10;\n" +
+		"        v /= 10;\n" +
+		"    } while (v != 0);\n" +
+		"    write(1, buf + i, sizeof(buf) - i);\n" +
+		"}\n\n" +
+		compileSyscallC()
+
+	var sb strings.Builder
+	sb.WriteString(header)
+	sb.WriteString(compileExternsC(program))
+	for _, quote := range program.Quotes {
+		fmt.Fprintf(&sb, "static void %v(void);\n", cRoutineName(quote))
+	}
+	sb.WriteString("\n")
+	// the C code that calls the exported quotes has its own main, so the top
+	// level of the program is left out like in an object file
+	standalone := !state.Object
+	for _, quote := range program.Quotes {
+		if quote.Export != "" {
+			standalone = false
+		}
+	}
+	if standalone {
+		sb.WriteString(compileRoutineC(program.Main, state))
+	}
+	for _, quote := range program.Quotes {
+		sb.WriteString(compileRoutineC(quote, state))
+		if quote.Export != "" {
+			sb.WriteString(compileExportC(quote))
+		}
+	}
+	if standalone {
+		sb.WriteString("int main(void) {\n" +
+			"    dodo_main();\n" +
+			"    return 0;\n" +
+			"}\n")
+	}
+
+	return sb.String()
+}
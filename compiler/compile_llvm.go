@@ -0,0 +1,386 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The llvm backend translates the IR into textual LLVM IR for x86-64 linux.
+// The data stack is an array alloca'd by main that grows upwards, its top,
+// the let frames and the bases used by the runtime checks are kept in a
+// %dodo.state that every routine gets as its only argument. Syscalls are
+// inline asm so that the output needs nothing but a linker and a C runtime
+
+// llvmStackCapacity is the number of elements of the data stack, it lives
+// on the machine stack so it only leaves room past the limit of -debug-stack
+// for the elements a block pushes before the next check
+const llvmStackCapacity = debugStackLimit/8 + 4096
+
+// llvmFunction numbers the temporaries of the routine being compiled
+type llvmFunction struct {
+	tmps int
+}
+
+func (fn *llvmFunction) tmp() string {
+	fn.tmps++
+	return fmt.Sprintf("%%t%v", fn.tmps)
+}
+
+// llvmString renders s as an LLVM string constant
+func llvmString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("c\"")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&sb, "\\%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString("\"")
+	return sb.String()
+}
+
+// compileRuntimeErrorLLVM exits with exitCode and msg when the i1 cond is true
+func compileRuntimeErrorLLVM(state *CompileState, cond string, loc Location, msg string, exitCode int) string {
+	id := len(state.RuntimeMsgs)
+	msg = fmt.Sprintf("%v:%v:%v: %v\n", loc.FilePath, loc.Line, loc.Col, msg)
+	state.RuntimeMsgs = append(state.RuntimeMsgs, msg)
+	return fmt.Sprintf("call void @runtime_error_if(i1 %v, ptr @runtime_msg_%v, i64 %v, i64 %v)\n",
+		cond, id, len(msg), exitCode)
+}
+
+func compileStackUnderflowCheckLLVM(state *CompileState, fn *llvmFunction, loc Location, n uint64) string {
+	under := fn.tmp()
+	return fmt.Sprintf("%v = call i1 @stack_underflows(ptr %%state, i64 %v)\n", under, n) +
+		compileRuntimeErrorLLVM(state, under, loc,
+			fmt.Sprintf("stack underflow, expected %v element(s)", n), exitCodeStackUnderflow)
+}
+
+func compileStackOverflowCheckLLVM(state *CompileState, fn *llvmFunction, loc Location) string {
+	over := fn.tmp()
+	return fmt.Sprintf("%v = call i1 @stack_overflows(ptr %%state)\n", over) +
+		compileRuntimeErrorLLVM(state, over, loc, "stack overflow", exitCodeStackOverflow)
+}
+
+func llvmPush(value string) string {
+	return fmt.Sprintf("call void @push(ptr %%state, i64 %v)\n", value)
+}
+
+func llvmPop(value string) string {
+	return fmt.Sprintf("%v = call i64 @pop(ptr %%state)\n", value)
+}
+
+// llvmBinaryOps are the instructions that replace the top two elements with their result
+var llvmBinaryOps = map[Op]string{
+	OpPlus: "add",
+	OpSub:  "sub",
+	OpMult: "mul",
+	OpGt:   "icmp sgt",
+	OpGe:   "icmp sge",
+	OpLt:   "icmp slt",
+	OpLe:   "icmp sle",
+	OpEq:   "icmp eq",
+}
+
+func compileInstrLLVM(instr Instr, state *CompileState, fn *llvmFunction) string {
+	assert(OpCount == 28, "Exhaustive switch case for compileInstrLLVM")
+	switch instr.Op {
+	case OpPushInt, OpPushBool:
+		return llvmPush(fmt.Sprint(int64(instr.Operand)))
+	case OpPushVar:
+		addr, value := fn.tmp(), fn.tmp()
+		return fmt.Sprintf("%v = getelementptr i8, ptr @vars_buffer, i64 %v\n", addr, instr.Operand) +
+			fmt.Sprintf("%v = ptrtoint ptr %v to i64\n", value, addr) +
+			llvmPush(value)
+	case OpPushQuote:
+		value := fn.tmp()
+		return fmt.Sprintf("%v = ptrtoint ptr @dodo_quote_%v to i64\n", value, instr.Operand) +
+			llvmPush(value)
+	case OpPlus, OpSub, OpMult:
+		b, a, result := fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(b) + llvmPop(a) +
+			fmt.Sprintf("%v = %v i64 %v, %v\n", result, llvmBinaryOps[instr.Op], a, b) +
+			llvmPush(result)
+	case OpGt, OpGe, OpLt, OpLe, OpEq:
+		b, a, cond, result := fn.tmp(), fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(b) + llvmPop(a) +
+			fmt.Sprintf("%v = %v i64 %v, %v\n", cond, llvmBinaryOps[instr.Op], a, b) +
+			fmt.Sprintf("%v = zext i1 %v to i64\n", result, cond) +
+			llvmPush(result)
+	case OpDivMod:
+		b, a := fn.tmp(), fn.tmp()
+		retStr := llvmPop(b) + llvmPop(a)
+		if state.Checked {
+			zero := fn.tmp()
+			retStr += fmt.Sprintf("%v = icmp eq i64 %v, 0\n", zero, b) +
+				compileRuntimeErrorLLVM(state, zero, instr.Loc, "division by zero", exitCodeDivByZero)
+		}
+		quot, rem := fn.tmp(), fn.tmp()
+		return retStr +
+			fmt.Sprintf("%v = udiv i64 %v, %v\n", quot, a, b) +
+			fmt.Sprintf("%v = urem i64 %v, %v\n", rem, a, b) +
+			llvmPush(quot) + llvmPush(rem)
+	case OpPrint:
+		value := fn.tmp()
+		return llvmPop(value) +
+			fmt.Sprintf("call void @print(i64 %v)\n", value)
+	case OpSwap:
+		b, a := fn.tmp(), fn.tmp()
+		return llvmPop(b) + llvmPop(a) + llvmPush(b) + llvmPush(a)
+	case OpDup:
+		a := fn.tmp()
+		return llvmPop(a) + llvmPush(a) + llvmPush(a)
+	case OpDrop:
+		return llvmPop(fn.tmp())
+	case OpRot:
+		c, b, a := fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(c) + llvmPop(b) + llvmPop(a) + llvmPush(b) + llvmPush(c) + llvmPush(a)
+	case OpSyscall1:
+		n, a1 := fn.tmp(), fn.tmp()
+		return llvmPop(n) + llvmPop(a1) +
+			fmt.Sprintf("call i64 @syscall(i64 %v, i64 %v, i64 0, i64 0)\n", n, a1)
+	case OpSyscall3:
+		n, a1, a2, a3 := fn.tmp(), fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(n) + llvmPop(a1) + llvmPop(a2) + llvmPop(a3) +
+			fmt.Sprintf("call i64 @syscall(i64 %v, i64 %v, i64 %v, i64 %v)\n", n, a1, a2, a3)
+	case OpRead:
+		value, addr, result := fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(value) +
+			fmt.Sprintf("%v = inttoptr i64 %v to ptr\n", addr, value) +
+			fmt.Sprintf("%v = load i64, ptr %v\n", result, addr) +
+			llvmPush(result)
+	case OpWrite:
+		value, ptr, addr := fn.tmp(), fn.tmp(), fn.tmp()
+		return llvmPop(value) + llvmPop(ptr) +
+			fmt.Sprintf("%v = inttoptr i64 %v to ptr\n", addr, ptr) +
+			fmt.Sprintf("store i64 %v, ptr %v\n", value, addr)
+	case OpCall:
+		value, quote := fn.tmp(), fn.tmp()
+		return llvmPop(value) +
+			fmt.Sprintf("%v = inttoptr i64 %v to ptr\n", quote, value) +
+			fmt.Sprintf("call void %v(ptr %%state)\n", quote)
+	case OpLet:
+		field, rp, frame := fn.tmp(), fn.tmp(), fn.tmp()
+		retStr := fmt.Sprintf("%v = getelementptr %%dodo.state, ptr %%state, i32 0, i32 1\n", field) +
+			fmt.Sprintf("%v = load ptr, ptr %v\n", rp, field) +
+			fmt.Sprintf("%v = getelementptr i64, ptr %v, i64 -%v\n", frame, rp, instr.Operand) +
+			fmt.Sprintf("store ptr %v, ptr %v\n", frame, field)
+		for slot := instr.Operand; slot > 0; slot-- {
+			value, addr := fn.tmp(), fn.tmp()
+			retStr += llvmPop(value) +
+				fmt.Sprintf("%v = getelementptr i64, ptr %v, i64 %v\n", addr, frame, slot-1) +
+				fmt.Sprintf("store i64 %v, ptr %v\n", value, addr)
+		}
+		return retStr
+	case OpLetEnd:
+		field, rp, frame := fn.tmp(), fn.tmp(), fn.tmp()
+		return fmt.Sprintf("%v = getelementptr %%dodo.state, ptr %%state, i32 0, i32 1\n", field) +
+			fmt.Sprintf("%v = load ptr, ptr %v\n", rp, field) +
+			fmt.Sprintf("%v = getelementptr i64, ptr %v, i64 %v\n", frame, rp, instr.Operand) +
+			fmt.Sprintf("store ptr %v, ptr %v\n", frame, field)
+	case OpLocal:
+		field, rp, addr, value := fn.tmp(), fn.tmp(), fn.tmp(), fn.tmp()
+		return fmt.Sprintf("%v = getelementptr %%dodo.state, ptr %%state, i32 0, i32 1\n", field) +
+			fmt.Sprintf("%v = load ptr, ptr %v\n", rp, field) +
+			fmt.Sprintf("%v = getelementptr i64, ptr %v, i64 %v\n", addr, rp, instr.Operand) +
+			fmt.Sprintf("%v = load i64, ptr %v\n", value, addr) +
+			llvmPush(value)
+	case OpAssert:
+		value, failed := fn.tmp(), fn.tmp()
+		return llvmPop(value) +
+			fmt.Sprintf("%v = icmp eq i64 %v, 0\n", failed, value) +
+			compileRuntimeErrorLLVM(state, failed, instr.Loc, "assertion failed", exitCodeAssert)
+	case OpCallExtern:
+		assert(false, "`extern` is rejected for this backend before compileInstrLLVM")
+	}
+	assert(false, "compileInstrLLVM unreachable")
+	return ""
+}
+
+func compileRoutineLLVM(routine Routine, state *CompileState) string {
+	var fn llvmFunction
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "define internal void @dodo_%v(ptr %%state) {\n", routine.Name)
+	// the entry block of a function cannot be the target of a branch
+	sb.WriteString("entry:\n")
+	if state.DebugStack && routine.Name != "main" {
+		sb.WriteString(indent(compileStackOverflowCheckLLVM(state, &fn, routine.Loc)))
+	}
+	sb.WriteString("  br label %b0\n")
+	for _, block := range routine.Blocks {
+		fmt.Fprintf(&sb, "b%v:\n", block.ID)
+		var code strings.Builder
+		if state.DebugStack && block.LoopHead {
+			code.WriteString(compileStackOverflowCheckLLVM(state, &fn, block.Loc))
+		}
+		for _, instr := range block.Instrs {
+			if n := stackArgCount(state, instr); state.DebugStack && n > 0 {
+				code.WriteString(compileStackUnderflowCheckLLVM(state, &fn, instr.Loc, n))
+			}
+			code.WriteString(compileInstrLLVM(instr, state, &fn))
+		}
+		term := block.Term
+		switch term.Kind {
+		case TermJump:
+			fmt.Fprintf(&code, "br label %%b%v\n", term.Then)
+		case TermBranch:
+			if state.DebugStack {
+				code.WriteString(compileStackUnderflowCheckLLVM(state, &fn, term.Loc, 1))
+			}
+			value, cond := fn.tmp(), fn.tmp()
+			code.WriteString(llvmPop(value) +
+				fmt.Sprintf("%v = icmp ne i64 %v, 0\n", cond, value) +
+				fmt.Sprintf("br i1 %v, label %%b%v, label %%b%v\n", cond, term.Then, term.Else))
+		case TermReturn:
+			code.WriteString("ret void\n")
+		}
+		sb.WriteString(indent(code.String()))
+	}
+	sb.WriteString("}\n\n")
+	return sb.String()
+}
+
+// indent indents every line of code by two spaces
+func indent(code string) string {
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func compileProgramLLVM(program Program, state *CompileState) string {
+	var routines strings.Builder
+	routines.WriteString(compileRoutineLLVM(program.Main, state))
+	for _, quote := range program.Quotes {
+		routines.WriteString(compileRoutineLLVM(quote, state))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("; generated by dodolang\n" +
+		"target triple = \"x86_64-pc-linux-gnu\"\n\n" +
+		"; top of the data stack, top of the let frames and the bases of both stacks\n" +
+		"%dodo.state = type { ptr, ptr, ptr, ptr }\n\n")
+	if state.varBufSize > 0 {
+		fmt.Fprintf(&sb, "@vars_buffer = internal global [%v x i8] zeroinitializer, align 8\n", state.varBufSize)
+	}
+	for id, msg := range state.RuntimeMsgs {
+		fmt.Fprintf(&sb, "@runtime_msg_%v = private unnamed_addr constant [%v x i8] %v\n", id, len(msg), llvmString(msg))
+	}
+	sb.WriteString(`
+define internal i64 @syscall(i64 %n, i64 %a1, i64 %a2, i64 %a3) {
+  %r = call i64 asm sideeffect "syscall", "={rax},{rax},{rdi},{rsi},{rdx},~{rcx},~{r11},~{memory}"(i64 %n, i64 %a1, i64 %a2, i64 %a3)
+  ret i64 %r
+}
+
+define internal void @push(ptr %state, i64 %v) alwaysinline {
+  %top = load ptr, ptr %state
+  store i64 %v, ptr %top
+  %next = getelementptr i64, ptr %top, i64 1
+  store ptr %next, ptr %state
+  ret void
+}
+
+define internal i64 @pop(ptr %state) alwaysinline {
+  %top = load ptr, ptr %state
+  %prev = getelementptr i64, ptr %top, i64 -1
+  store ptr %prev, ptr %state
+  %v = load i64, ptr %prev
+  ret i64 %v
+}
+
+define internal void @runtime_error_if(i1 %cond, ptr %msg, i64 %len, i64 %code) alwaysinline {
+entry:
+  br i1 %cond, label %error, label %ok
+error:
+  %m = ptrtoint ptr %msg to i64
+  call i64 @syscall(i64 1, i64 2, i64 %m, i64 %len)
+  call i64 @syscall(i64 60, i64 %code, i64 0, i64 0)
+  unreachable
+ok:
+  ret void
+}
+
+define internal i1 @stack_underflows(ptr %state, i64 %n) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %need = mul i64 %n, 8
+  %under = icmp ult i64 %size, %need
+  ret i1 %under
+}
+
+define internal i1 @stack_overflows(ptr %state) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+` + fmt.Sprintf("  %%data = icmp ugt i64 %%size, %v\n", debugStackLimit) + `  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %rp = load ptr, ptr %rp.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  %ret = load ptr, ptr %ret.field
+  %r = ptrtoint ptr %rp to i64
+  %rb = ptrtoint ptr %ret to i64
+  %room = sub i64 %r, %rb
+  ; leave room for a let frame to be pushed
+  %frames = icmp ult i64 %room, 64
+  %over = or i1 %data, %frames
+  ret i1 %over
+}
+
+; print writes v as a decimal number and a newline to stdout
+define internal void @print(i64 %v) {
+entry:
+  %buf = alloca [21 x i8]
+  %nl = getelementptr [21 x i8], ptr %buf, i64 0, i64 20
+  store i8 10, ptr %nl
+  br label %digit
+digit:
+  %i = phi i64 [ 20, %entry ], [ %i.next, %digit ]
+  %n = phi i64 [ %v, %entry ], [ %n.next, %digit ]
+  %i.next = sub i64 %i, 1
+  %r = urem i64 %n, 10
+  %r8 = trunc i64 %r to i8
+  %c = add i8 %r8, 48
+  %p = getelementptr [21 x i8], ptr %buf, i64 0, i64 %i.next
+  store i8 %c, ptr %p
+  %n.next = udiv i64 %n, 10
+  %more = icmp ne i64 %n.next, 0
+  br i1 %more, label %digit, label %done
+done:
+  %start = ptrtoint ptr %p to i64
+  %len = sub i64 21, %i.next
+  call i64 @syscall(i64 1, i64 1, i64 %start, i64 %len)
+  ret void
+}
+
+define i32 @main() {
+` + fmt.Sprintf("  %%stack = alloca [%v x i64], align 8\n", llvmStackCapacity) + `  %ret_stack = alloca [1024 x i64], align 8
+  %state = alloca %dodo.state
+  %ret_stack_end = getelementptr [1024 x i64], ptr %ret_stack, i64 0, i64 1024
+  %sp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 0
+  store ptr %stack, ptr %sp.field
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  store ptr %ret_stack_end, ptr %rp.field
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  store ptr %stack, ptr %base.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  store ptr %ret_stack, ptr %ret.field
+  call void @dodo_main(ptr %state)
+  ret i32 0
+}
+
+`)
+	sb.WriteString(routines.String())
+
+	return sb.String()
+}
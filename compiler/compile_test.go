@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// runProgram assembles and runs the x86_64 code of a program, it skips the
+// test on machines that cannot run it
+func runProgram(t *testing.T, code string) (string, int) {
+	t.Helper()
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("the built programs only run on linux/amd64")
+	}
+	exe, err := Assemble(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exePath := filepath.Join(t.TempDir(), "test")
+	if err := os.WriteFile(exePath, exe, 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(exePath).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestCompareBranch(t *testing.T) {
+	ops := []struct {
+		word    string
+		op      Op
+		compare func(a, b int) bool
+		loop    string
+	}{
+		{">", OpGt, func(a, b int) bool { return a > b }, "0\n"},
+		{">=", OpGe, func(a, b int) bool { return a >= b }, "0\n"},
+		{"<", OpLt, func(a, b int) bool { return a < b }, "3\n"},
+		{"<=", OpLe, func(a, b int) bool { return a <= b }, "4\n"},
+		{"=", OpEq, func(a, b int) bool { return a == b }, "0\n"},
+	}
+	// -1 is computed as there are no negative literals
+	pairs := []struct {
+		a, b   int
+		source string
+	}{
+		{1, 2, "1 2"},
+		{2, 1, "2 1"},
+		{2, 2, "2 2"},
+		{-1, 1, "0 1 - 1"},
+		{1, -1, "1 0 1 -"},
+	}
+	for _, o := range ops {
+		var src, want strings.Builder
+		for _, p := range pairs {
+			fmt.Fprintf(&src, "%v %v if 1 print else 0 print end\n", p.source, o.word)
+			if o.compare(p.a, p.b) {
+				want.WriteString("1\n")
+			} else {
+				want.WriteString("0\n")
+			}
+		}
+		fmt.Fprintf(&src, "0 for dup 3 %v do 1 + end print\n", o.word)
+		want.WriteString(o.loop)
+		for _, opts := range []Options{{}, {NoPeephole: true}, {DebugStack: true}} {
+			t.Run(fmt.Sprintf("%v/%+v", o.word, opts), func(t *testing.T) {
+				opts.FilePath = "test.dodo"
+				result, diags := Compile(src.String(), opts)
+				if HasErrors(diags) {
+					t.Fatalf("unexpected diagnostics %v", diags)
+				}
+				code := stripAsm(result.Code)
+				// the comparison jumps to the else branch, which follows the then branch
+				if fused := fmt.Sprintf("cmp r12, r13\n%v main_b2\n", invertedJump[o.op]); opts.NoPeephole && !strings.Contains(code, fused) {
+					t.Errorf("the code has no\n%v", fused)
+				}
+				if strings.Contains(code, "\nset") {
+					t.Errorf("the comparison is materialised before the branch")
+				}
+				if out, exit := runProgram(t, result.Code); out != want.String() || exit != 0 {
+					t.Errorf("got output %q and exit code %v, want %q", out, exit, want.String())
+				}
+			})
+		}
+	}
+}
+
+func TestCompareBranchStackCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		want   string
+		output string
+	}{
+		{
+			// the values below the compared ones are spilled before the jump
+			"cached values below",
+			"7 1 2 < if 5 print end print\n",
+			"push r12\ncmp r13, r14\njge main_b2\n",
+			"5\n7\n",
+		},
+		{
+			"compared values on the machine stack",
+			"1 2 3 print < if 5 print end\n",
+			"call print\npop r12\npop r13\ncmp r13, r12\njge main_b2\n",
+			"3\n5\n",
+		},
+		{
+			"one compared value cached",
+			"1 2 print 3 > if 5 print end\n",
+			"mov r12, 3\npop r13\ncmp r13, r12\njle main_b2\n",
+			"2\n",
+		},
+		{
+			// the bool is kept when it is used by more than the branch
+			"bool used twice",
+			"1 2 < dup if 5 print end print\n",
+			"; -- Branch --",
+			"5\n1\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, diags := Compile(test.src, Options{FilePath: "test.dodo", NoPeephole: true})
+			if HasErrors(diags) {
+				t.Fatalf("unexpected diagnostics %v", diags)
+			}
+			code := result.Code
+			if !strings.HasPrefix(test.want, ";") {
+				code = stripAsm(code)
+			}
+			if !strings.Contains(code, test.want) {
+				t.Errorf("the code has no\n%v\nin\n%v", test.want, code)
+			}
+			if out, exit := runProgram(t, result.Code); out != test.output || exit != 0 {
+				t.Errorf("got output %q and exit code %v, want %q", out, exit, test.output)
+			}
+		})
+	}
+}
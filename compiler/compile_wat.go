@@ -0,0 +1,462 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The wat backend lowers the IR to a WebAssembly text module for WASI.
+// The data stack is kept in linear memory and grows down from
+// wasmDataStackEnd with the $sp global pointing at its top, let frames live
+// on a second stack pointed to by $rp and quotes are called through a table.
+// As wasm control flow is structured, every routine is a loop around a
+// br_table that dispatches to the block in the $block local
+
+// layout of the linear memory
+const (
+	wasmIovec       = 0 // iovec and written byte count of fd_write
+	wasmPrintBuffer = 16
+	wasmVarsBuffer  = 64
+	// wasmDataStackSize is the size of the data stack, the same 8MB as the
+	// default stack limit of linux that the x86-64 code runs on
+	wasmDataStackSize = 8 * 1024 * 1024
+	wasmRetStackSize  = 8 * 1024
+	wasmPageSize      = 64 * 1024
+)
+
+// wasiSyscalls are the x86-64 syscall numbers that $syscall runs through WASI
+var wasiSyscalls = []uint64{1, 60, 231}
+
+// wasmLayout places the stacks after vars_buffer and the runtime messages after the stacks
+type wasmLayout struct {
+	retStack     uint64
+	retStackEnd  uint64
+	dataStackEnd uint64
+	msgs         uint64
+}
+
+func newWasmLayout(state *CompileState) wasmLayout {
+	var l wasmLayout
+	l.retStack = (wasmVarsBuffer + state.varBufSize + 7) / 8 * 8
+	l.retStackEnd = l.retStack + wasmRetStackSize
+	l.dataStackEnd = l.retStackEnd + wasmDataStackSize
+	l.msgs = l.dataStackEnd
+	return l
+}
+
+// watString renders s as a wat string literal
+func watString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("\"")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&sb, "\\%02x", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString("\"")
+	return sb.String()
+}
+
+func compileRuntimeErrorWat(state *CompileState, layout wasmLayout, loc Location, msg string, exitCode int) string {
+	offset := layout.msgs
+	for _, m := range state.RuntimeMsgs {
+		offset += uint64(len(m))
+	}
+	msg = fmt.Sprintf("%v:%v:%v: %v\n", loc.FilePath, loc.Line, loc.Col, msg)
+	state.RuntimeMsgs = append(state.RuntimeMsgs, msg)
+	retStr := fmt.Sprintf("i32.const %v\n", offset) +
+		fmt.Sprintf("i32.const %v\n", len(msg)) +
+		fmt.Sprintf("i32.const %v\n", exitCode) +
+		"call $runtime_error\n"
+	return retStr
+}
+
+func compileStackUnderflowCheckWat(state *CompileState, layout wasmLayout, loc Location, n uint64) string {
+	retStr := ";; -- Stack Underflow Check --\n" +
+		"global.get $sp\n" +
+		fmt.Sprintf("i32.const %v\n", layout.dataStackEnd-8*n) +
+		"i32.gt_u\n" +
+		"if\n" +
+		compileRuntimeErrorWat(
+			state,
+			layout,
+			loc,
+			fmt.Sprintf("stack underflow, expected %v element(s)", n),
+			exitCodeStackUnderflow,
+		) +
+		"end\n"
+	return retStr
+}
+
+func compileStackOverflowCheckWat(state *CompileState, layout wasmLayout, loc Location) string {
+	retStr := ";; -- Stack Overflow Check --\n" +
+		"global.get $sp\n" +
+		fmt.Sprintf("i32.const %v\n", layout.dataStackEnd-debugStackLimit) +
+		"i32.lt_u\n" +
+		"global.get $rp\n" +
+		// leave room for a let frame to be pushed
+		fmt.Sprintf("i32.const %v\n", layout.retStack+64) +
+		"i32.lt_u\n" +
+		"i32.or\n" +
+		"if\n" +
+		compileRuntimeErrorWat(state, layout, loc, "stack overflow", exitCodeStackOverflow) +
+		"end\n"
+	return retStr
+}
+
+// watBinaryOps are the instructions that replace the top two elements with their result
+var watBinaryOps = map[Op]string{
+	OpPlus: "i64.add",
+	OpSub:  "i64.sub",
+	OpMult: "i64.mul",
+	OpGt:   "i64.gt_s\ni64.extend_i32_u",
+	OpGe:   "i64.ge_s\ni64.extend_i32_u",
+	OpLt:   "i64.lt_s\ni64.extend_i32_u",
+	OpLe:   "i64.le_s\ni64.extend_i32_u",
+	OpEq:   "i64.eq\ni64.extend_i32_u",
+}
+
+func compileInstrWat(instr Instr, state *CompileState, layout wasmLayout) string {
+	assert(OpCount == 28, "Exhaustive switch case for compileInstrWat")
+	switch instr.Op {
+	case OpPushInt, OpPushBool:
+		return fmt.Sprintf("i64.const %v\n", int64(instr.Operand)) +
+			"call $push\n"
+	case OpPushVar:
+		return fmt.Sprintf("i64.const %v\n", wasmVarsBuffer+instr.Operand) +
+			"call $push\n"
+	case OpPushQuote:
+		// index of the quote in the table
+		return fmt.Sprintf("i64.const %v\n", instr.Operand) +
+			"call $push\n"
+	case OpPlus, OpSub, OpMult, OpGt, OpGe, OpLt, OpLe, OpEq:
+		return "call $pop\n" +
+			"local.set $b\n" +
+			"call $pop\n" +
+			"local.get $b\n" +
+			watBinaryOps[instr.Op] + "\n" +
+			"call $push\n"
+	case OpDivMod:
+		retStr := "call $pop\n" +
+			"local.set $b\n" +
+			"call $pop\n" +
+			"local.set $a\n"
+		if state.Checked {
+			retStr += "local.get $b\n" +
+				"i64.eqz\n" +
+				"if\n" +
+				compileRuntimeErrorWat(state, layout, instr.Loc, "division by zero", exitCodeDivByZero) +
+				"end\n"
+		}
+		return retStr +
+			"local.get $a\n" +
+			"local.get $b\n" +
+			"i64.div_u\n" +
+			"call $push\n" +
+			"local.get $a\n" +
+			"local.get $b\n" +
+			"i64.rem_u\n" +
+			"call $push\n"
+	case OpPrint:
+		return "call $pop\n" +
+			"call $print\n"
+	case OpSwap:
+		return "call $pop\n" +
+			"local.set $b\n" +
+			"call $pop\n" +
+			"local.set $a\n" +
+			"local.get $b\n" +
+			"call $push\n" +
+			"local.get $a\n" +
+			"call $push\n"
+	case OpDup:
+		return "call $pop\n" +
+			"local.tee $a\n" +
+			"call $push\n" +
+			"local.get $a\n" +
+			"call $push\n"
+	case OpDrop:
+		return "call $pop\n" +
+			"drop\n"
+	case OpRot:
+		return "call $pop\n" +
+			"local.set $c\n" +
+			"call $pop\n" +
+			"local.set $b\n" +
+			"call $pop\n" +
+			"local.set $a\n" +
+			"local.get $b\n" +
+			"call $push\n" +
+			"local.get $c\n" +
+			"call $push\n" +
+			"local.get $a\n" +
+			"call $push\n"
+	case OpSyscall1:
+		return "call $pop\n" +
+			"call $pop\n" +
+			"i64.const 0\n" +
+			"i64.const 0\n" +
+			"call $syscall\n"
+	case OpSyscall3:
+		return "call $pop\n" +
+			"call $pop\n" +
+			"call $pop\n" +
+			"call $pop\n" +
+			"call $syscall\n"
+	case OpRead:
+		return "call $pop\n" +
+			"i32.wrap_i64\n" +
+			"i64.load\n" +
+			"call $push\n"
+	case OpWrite:
+		return "call $pop\n" +
+			"local.set $b\n" +
+			"call $pop\n" +
+			"i32.wrap_i64\n" +
+			"local.get $b\n" +
+			"i64.store\n"
+	case OpCall:
+		return "call $pop\n" +
+			"i32.wrap_i64\n" +
+			"call_indirect (type $routine)\n"
+	case OpLet:
+		retStr := "global.get $rp\n" +
+			fmt.Sprintf("i32.const %v\n", 8*instr.Operand) +
+			"i32.sub\n" +
+			"global.set $rp\n"
+		for slot := instr.Operand; slot > 0; slot-- {
+			retStr += "global.get $rp\n" +
+				"call $pop\n" +
+				fmt.Sprintf("i64.store offset=%v\n", 8*(slot-1))
+		}
+		return retStr
+	case OpLetEnd:
+		return "global.get $rp\n" +
+			fmt.Sprintf("i32.const %v\n", 8*instr.Operand) +
+			"i32.add\n" +
+			"global.set $rp\n"
+	case OpLocal:
+		return "global.get $rp\n" +
+			fmt.Sprintf("i64.load offset=%v\n", 8*instr.Operand) +
+			"call $push\n"
+	case OpAssert:
+		return "call $pop\n" +
+			"i64.eqz\n" +
+			"if\n" +
+			compileRuntimeErrorWat(state, layout, instr.Loc, "assertion failed", exitCodeAssert) +
+			"end\n"
+	case OpCallExtern:
+		assert(false, "`extern` is rejected for this backend before compileInstrWat")
+	}
+	assert(false, "compileInstrWat unreachable")
+	return ""
+}
+
+func compileJumpWat(target int) string {
+	return fmt.Sprintf("i32.const %v\n", target) +
+		"local.set $block\n" +
+		"br $dispatch\n"
+}
+
+func compileRoutineWat(routine Routine, state *CompileState, layout wasmLayout) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(func $%v (type $routine) (local $block i32) (local $a i64) (local $b i64) (local $c i64)\n", routine.Name)
+	if state.DebugStack && routine.Name != "main" {
+		sb.WriteString(compileStackOverflowCheckWat(state, layout, routine.Loc))
+	}
+	sb.WriteString("loop $dispatch\n")
+	for i := len(routine.Blocks) - 1; i >= 0; i-- {
+		fmt.Fprintf(&sb, "block $b%v\n", i)
+	}
+	sb.WriteString("local.get $block\n" +
+		"br_table")
+	for _, block := range routine.Blocks {
+		fmt.Fprintf(&sb, " $b%v", block.ID)
+	}
+	sb.WriteString("\n")
+	for _, block := range routine.Blocks {
+		fmt.Fprintf(&sb, "end ;; -- Block %v --\n", block.ID)
+		if state.DebugStack && block.LoopHead {
+			sb.WriteString(compileStackOverflowCheckWat(state, layout, block.Loc))
+		}
+		for _, instr := range block.Instrs {
+			if n := stackArgCount(state, instr); state.DebugStack && n > 0 {
+				sb.WriteString(compileStackUnderflowCheckWat(state, layout, instr.Loc, n))
+			}
+			sb.WriteString(compileInstrWat(instr, state, layout))
+		}
+		term := block.Term
+		switch term.Kind {
+		case TermJump:
+			if term.Then != block.ID+1 {
+				sb.WriteString(compileJumpWat(term.Then))
+			}
+		case TermBranch:
+			if state.DebugStack {
+				sb.WriteString(compileStackUnderflowCheckWat(state, layout, term.Loc, 1))
+			}
+			sb.WriteString("call $pop\n" +
+				"i64.eqz\n" +
+				"if\n" +
+				compileJumpWat(term.Else) +
+				"end\n")
+			if term.Then != block.ID+1 {
+				sb.WriteString(compileJumpWat(term.Then))
+			}
+		case TermReturn:
+			sb.WriteString("return\n")
+		}
+	}
+	sb.WriteString("end\n" +
+		")\n\n")
+	return sb.String()
+}
+
+func compileProgramWat(program Program, state *CompileState) string {
+	layout := newWasmLayout(state)
+	var routines strings.Builder
+	routines.WriteString(compileRoutineWat(program.Main, state, layout))
+	for _, quote := range program.Quotes {
+		routines.WriteString(compileRoutineWat(quote, state, layout))
+	}
+	msgsEnd := layout.msgs
+	for _, msg := range state.RuntimeMsgs {
+		msgsEnd += uint64(len(msg))
+	}
+	pages := (msgsEnd + wasmPageSize - 1) / wasmPageSize
+
+	var sb strings.Builder
+	sb.WriteString(";; generated by dodolang\n" +
+		"(module\n" +
+		"(import \"wasi_snapshot_preview1\" \"fd_write\" (func $fd_write (param i32 i32 i32 i32) (result i32)))\n" +
+		"(import \"wasi_snapshot_preview1\" \"proc_exit\" (func $proc_exit (param i32)))\n" +
+		"(type $routine (func))\n" +
+		fmt.Sprintf("(memory (export \"memory\") %v)\n", pages) +
+		fmt.Sprintf("(global $sp (mut i32) (i32.const %v))\n", layout.dataStackEnd) +
+		fmt.Sprintf("(global $rp (mut i32) (i32.const %v))\n", layout.retStackEnd))
+	if len(program.Quotes) > 0 {
+		fmt.Fprintf(&sb, "(table %v funcref)\n", len(program.Quotes))
+		sb.WriteString("(elem (i32.const 0)")
+		for _, quote := range program.Quotes {
+			fmt.Fprintf(&sb, " $%v", quote.Name)
+		}
+		sb.WriteString(")\n")
+	}
+	if len(state.RuntimeMsgs) > 0 {
+		fmt.Fprintf(&sb, "(data (i32.const %v) %v)\n", layout.msgs, watString(strings.Join(state.RuntimeMsgs, "")))
+	}
+	sb.WriteString("(export \"_start\" (func $_start))\n\n")
+
+	sb.WriteString(`(func $push (param $v i64)
+global.get $sp
+i32.const 8
+i32.sub
+global.set $sp
+global.get $sp
+local.get $v
+i64.store
+)
+
+(func $pop (result i64)
+global.get $sp
+i64.load
+global.get $sp
+i32.const 8
+i32.add
+global.set $sp
+)
+
+(func $write (param $fd i32) (param $ptr i32) (param $len i32)
+` + fmt.Sprintf("i32.const %v\n", wasmIovec) + `local.get $ptr
+i32.store
+` + fmt.Sprintf("i32.const %v\n", wasmIovec+4) + `local.get $len
+i32.store
+local.get $fd
+` + fmt.Sprintf("i32.const %v\n", wasmIovec) + `i32.const 1
+` + fmt.Sprintf("i32.const %v\n", wasmIovec+8) + `call $fd_write
+drop
+)
+
+;; print writes v as a decimal number and a newline to stdout
+(func $print (param $v i64) (local $p i32)
+` + fmt.Sprintf("i32.const %v\n", wasmPrintBuffer+21) + `local.tee $p
+i32.const 10
+i32.store8
+loop $digit
+local.get $p
+i32.const 1
+i32.sub
+local.tee $p
+local.get $v
+i64.const 10
+i64.rem_u
+i64.const 48
+i64.add
+i64.store8
+local.get $v
+i64.const 10
+i64.div_u
+local.tee $v
+i64.const 0
+i64.ne
+br_if $digit
+end
+i32.const 1
+local.get $p
+` + fmt.Sprintf("i32.const %v\n", wasmPrintBuffer+22) + `local.get $p
+i32.sub
+call $write
+)
+
+(func $runtime_error (param $msg i32) (param $len i32) (param $code i32)
+i32.const 2
+local.get $msg
+local.get $len
+call $write
+local.get $code
+call $proc_exit
+)
+
+;; syscall supports the x86-64 write and exit syscalls through WASI, others trap
+(func $syscall (param $n i64) (param $a1 i64) (param $a2 i64) (param $a3 i64)
+local.get $n
+i64.const 1
+i64.eq
+if
+local.get $a1
+i32.wrap_i64
+local.get $a2
+i32.wrap_i64
+local.get $a3
+i32.wrap_i64
+call $write
+return
+end
+local.get $n
+i64.const 60
+i64.eq
+local.get $n
+i64.const 231
+i64.eq
+i32.or
+if
+local.get $a1
+i32.wrap_i64
+call $proc_exit
+end
+unreachable
+)
+
+(func $_start
+call $main
+)
+
+`)
+	sb.WriteString(routines.String())
+	sb.WriteString(")\n")
+
+	return sb.String()
+}
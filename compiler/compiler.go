@@ -0,0 +1,202 @@
+package compiler
+
+import (
+	"slices"
+	"strings"
+)
+
+// Options select the target and the checks of a compilation, the zero
+// value builds x86_64 nasm assembly for an executable
+type Options struct {
+	// FilePath names the source in diagnostics, runtime errors and debug info
+	FilePath string
+	// Emit is `asm` (the default), `c`, `wat` or `llvm`
+	Emit string
+	// Arch of the assembly is `x86_64` (the default) or `arm64`
+	Arch string
+	// Syntax of the x86_64 assembly is `nasm` (the default) or `gas`
+	Syntax string
+	// Object leaves out `_start`, as the assembly is linked into a C program
+	Object     bool
+	Checked    bool
+	DebugStack bool
+	Optimize   bool
+	NoPeephole bool
+	// Annotate comments the assembly with the tokens it comes from,
+	// AnnotateSource also interleaves the source lines
+	Annotate       bool
+	AnnotateSource bool
+}
+
+// Result is the output of a successful compilation
+type Result struct {
+	// Code is the generated assembly, C, WebAssembly text or LLVM IR
+	Code string
+	// Externs are the C functions the program calls, which have to be linked in
+	Externs []string
+}
+
+// compiler holds the symbol tables of a single compilation
+type compiler struct {
+	vars   map[string]Token
+	macros map[string]Macro
+	quotes []Quote
+	// C functions declared with `extern`, called through the SysV calling convention
+	externs []Extern
+	// index in quotes of the routines exported as C symbols
+	exports map[string]int
+	// words the parser reported as undefined, they stay undefined even
+	// when a macro with their name is defined after them
+	undefined map[int]bool
+	// macros whose body is being checked or expanded, to stop at recursion
+	expanding map[string]bool
+	diags     Diagnostics
+}
+
+// Compile translates the dodo source src, the diagnostics are sorted by
+// location and the result is only valid when none of them is an error.
+// Every call has its own state, so Compile can be called concurrently
+func Compile(src string, opts Options) (Result, []Diagnostic) {
+	c := compiler{
+		vars:      make(map[string]Token, 100),
+		macros:    make(map[string]Macro, 100),
+		exports:   make(map[string]int, 100),
+		undefined: make(map[int]bool),
+		expanding: make(map[string]bool),
+	}
+	c.diags.addSource(opts.FilePath, src)
+	result := c.compile(src, opts)
+	var diags []Diagnostic
+	for _, d := range c.diags.sorted() {
+		diags = append(diags, *d)
+	}
+	if c.diags.hasErrors() {
+		result = Result{}
+	}
+	return result, diags
+}
+
+func (c *compiler) compile(src string, opts Options) Result {
+	emit, arch, syntax := opts.Emit, opts.Arch, opts.Syntax
+	if emit == "" {
+		emit = "asm"
+	}
+	if arch == "" {
+		arch = "x86_64"
+	}
+	if syntax == "" {
+		syntax = "nasm"
+	}
+	option := Location{FilePath: opts.FilePath}
+	switch {
+	case emit != "asm" && emit != "c" && emit != "wat" && emit != "llvm":
+		c.diags.errorf(option, ErrInvalidOption, "unknown emit kind `%v`, expected `asm`, `c`, `wat` or `llvm`", emit)
+	case arch != "x86_64" && arch != "arm64":
+		c.diags.errorf(option, ErrInvalidOption, "unknown architecture `%v`, expected `x86_64` or `arm64`", arch)
+	case syntax != "nasm" && syntax != "gas":
+		c.diags.errorf(option, ErrInvalidOption, "unknown assembly syntax `%v`, expected `nasm` or `gas`", syntax)
+	}
+	if c.diags.hasErrors() {
+		return Result{}
+	}
+
+	state := CompileState{
+		Checked:    opts.Checked,
+		DebugStack: opts.DebugStack,
+		Peephole:   !opts.NoPeephole,
+		Object:     opts.Object,
+	}
+	strTokens := lexFile(src, opts.FilePath)
+	if opts.Annotate || opts.AnnotateSource {
+		state.Annotate = true
+		state.AnnotateSource = opts.AnnotateSource
+		state.SourceLines = strings.Split(src, "\n")
+		state.TokenText = make(map[Location]string)
+		for _, token := range strTokens {
+			state.TokenText[token.Loc] = token.Content
+		}
+	}
+	tokens := c.parseTokens(strTokens, &state)
+	c.typeCheck(strTokens, tokens)
+	if c.diags.hasErrors() {
+		return Result{}
+	}
+
+	program := c.buildIR(strTokens, tokens)
+	if c.diags.hasErrors() {
+		return Result{}
+	}
+	if opts.Optimize {
+		optimizeProgram(&program)
+	}
+	if emit == "wat" || emit == "llvm" || (arch == "arm64" && emit != "c") {
+		c.checkNoFFI(program, emit, arch)
+		if c.diags.hasErrors() {
+			return Result{}
+		}
+	}
+	if emit == "wat" {
+		c.checkWasiSyscalls(program)
+		if c.diags.hasErrors() {
+			return Result{}
+		}
+	}
+	var result Result
+	for _, extern := range program.Externs {
+		result.Externs = append(result.Externs, extern.Name)
+	}
+	switch {
+	case emit == "c":
+		result.Code = compileProgramC(program, &state)
+	case emit == "wat":
+		result.Code = compileProgramWat(program, &state)
+	case emit == "llvm":
+		result.Code = compileProgramLLVM(program, &state)
+	case arch == "arm64":
+		result.Code = compileProgramArm64(program, &state)
+	case syntax == "gas":
+		code, err := translateToGas(compileProgram(program, &state))
+		if err != nil {
+			c.diags.errorf(option, ErrUnsupported, "the generated assembly cannot be translated to gas: %v", err)
+			return Result{}
+		}
+		result.Code = code
+	default:
+		result.Code = compileProgram(program, &state)
+	}
+	return result
+}
+
+// checkNoFFI reports the `extern` and `export` definitions of a program,
+// which the backends without a C calling convention cannot build
+func (c *compiler) checkNoFFI(program Program, emit string, arch string) {
+	target := emit
+	if emit == "asm" {
+		target = arch
+	}
+	for _, extern := range program.Externs {
+		c.diags.errorf(extern.Loc, ErrUnsupported, "`extern` is not supported by the %v backend, only by x86_64 and C", target)
+	}
+	for _, quote := range program.Quotes {
+		if quote.Export != "" {
+			c.diags.errorf(quote.Loc, ErrUnsupported, "`export` is not supported by the %v backend, only by x86_64 and C", target)
+		}
+	}
+}
+
+// checkWasiSyscalls reports the syscalls with a literal number that the wat
+// backend cannot run, the ones with a computed number trap at runtime
+func (c *compiler) checkWasiSyscalls(program Program) {
+	for _, routine := range append([]Routine{program.Main}, program.Quotes...) {
+		for _, block := range routine.Blocks {
+			for i, instr := range block.Instrs {
+				if (instr.Op != OpSyscall1 && instr.Op != OpSyscall3) || i == 0 || block.Instrs[i-1].Op != OpPushInt {
+					continue
+				}
+				if n := block.Instrs[i-1].Operand; !slices.Contains(wasiSyscalls, n) {
+					c.diags.errorf(instr.Loc, ErrUnsupported, "syscall %v is not supported by the wat backend, only write (1), exit (60) and exit_group (231) are", n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func diagnosticCodes(diags []Diagnostic) []Code {
+	var codes []Code
+	for _, d := range diags {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Code
+	}{
+		{"recursive macro", "macro rec 1 rec end rec\n", []Code{ErrUndefinedWord}},
+		{"mutually recursive macros", "macro a b end macro b a end a\n", []Code{ErrUndefinedWord}},
+		{"redefined macro", "macro a 1 end\nmacro a a end\na print\n", []Code{ErrRecursiveMacro}},
+		{"macro shadowing a var", "var a int end\nmacro a a end\na @ print\n", []Code{ErrRecursiveMacro}},
+		{
+			"recursion through declared effects",
+			"macro a ( -- int ) 1 end\nmacro b ( -- int ) a end\nmacro a ( -- int ) b end\na print\n",
+			[]Code{ErrRecursiveMacro},
+		},
+		{"nested macros", "macro a 1 end\nmacro b a end\nmacro c b b + end\nc print\n", nil},
+		{"independent errors", "1 print\ndrop\n2 print\ndrop\n", []Code{ErrStackUnderflow, ErrStackUnderflow}},
+		{
+			"errors after a type mismatch",
+			"1 if 2 print end\nvar p int end\n1 @ print\np true !\n[ 1 ] 2 call print\n5 6 + print\n",
+			[]Code{ErrTypeMismatch, ErrTypeMismatch, ErrTypeMismatch, ErrTypeMismatch},
+		},
+		{"errors in and after a quote", "[ drop ] drop\ndrop\n", []Code{ErrStackUnderflow, ErrStackUnderflow}},
+		{"only a comment", "// hi", nil},
+		{"no newline at the end", "1 print", nil},
+		{"undefined word at the end", "1 print\nfoo", []Code{ErrUndefinedWord}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Compile(test.src, Options{FilePath: "test.dodo"})
+			if got := diagnosticCodes(diags); !slices.Equal(got, test.want) {
+				t.Errorf("got diagnostics %v, want %v\n%v", got, test.want, diags)
+			}
+		})
+	}
+}
+
+func TestCMain(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		object bool
+		want   bool
+	}{
+		{"program", "1 print\n", false, true},
+		{"program with externs", "extern c_add ( int int -- int )\n1 2 c_add print\n", false, true},
+		{"program with exports", "export dodo_square [ ( int -- int ) dup * ]\n1 print\n", false, false},
+		{"object", "1 print\n", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, diags := Compile(test.src, Options{FilePath: "test.dodo", Emit: "c", Object: test.object})
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics %v", diags)
+			}
+			if got := strings.Contains(result.Code, "int main(void)"); got != test.want {
+				t.Errorf("got main %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWasiSyscalls(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Code
+	}{
+		{"write", "0 0 1 1 syscall3\n", nil},
+		{"exit", "0 60 syscall1\n", nil},
+		{"exit_group", "0 231 syscall1\n", nil},
+		{"literal unsupported number", "0 0 0 39 syscall3\n0 12 syscall1\n", []Code{ErrUnsupported, ErrUnsupported}},
+		{"computed number", "0 0 0 30 9 + syscall3\n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Compile(test.src, Options{FilePath: "test.dodo", Emit: "wat"})
+			if got := diagnosticCodes(diags); !slices.Equal(got, test.want) {
+				t.Errorf("got diagnostics %v, want %v\n%v", got, test.want, diags)
+			}
+		})
+	}
+}
+
+// typedPointer matches the pointer types that LLVM 17 no longer parses
+var typedPointer = regexp.MustCompile(`(i\d+|%[\w.]+|\]|\))\*`)
+
+func TestLLVMOpaquePointers(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("..", "examples", "*.dodo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range sources {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, diags := Compile(string(src), Options{FilePath: path, Emit: "llvm", Checked: true, DebugStack: true})
+			if HasErrors(diags) {
+				t.Fatalf("unexpected diagnostics %v", diags)
+			}
+			for i, line := range strings.Split(result.Code, "\n") {
+				if typedPointer.MatchString(line) && !strings.HasPrefix(line, ";") {
+					t.Errorf("line %v uses a typed pointer: %v", i+1, line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Severity uint
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	assert(false, "unreachable severity")
+	return ""
+}
+
+// Code identifies the kind of a diagnostic, codes never change their meaning
+// so they can be looked up and filtered on, errors start with `E` and warnings with `W`
+type Code string
+
+const (
+	ErrUndefinedWord    Code = "E0001" // a word that is not a keyword, macro, variable, binding or extern
+	ErrUnmatched        Code = "E0002" // `else`, `do`, `end`, `in` or `]` without the keyword that opens it
+	ErrUnclosed         Code = "E0003" // a block, quotation or macro that is never closed
+	ErrMalformed        Code = "E0004" // a `var`, `let`, `extern`, `export` or stack effect that does not parse
+	ErrInvalidName      Code = "E0005" // a keyword or number used as a name
+	ErrDuplicateName    Code = "E0006" // a name that is defined or bound more than once
+	ErrReservedName     Code = "E0007" // a symbol name that the generated code uses
+	ErrMisplaced        Code = "E0008" // a definition that is not allowed where it appears
+	ErrCSignature       Code = "E0009" // an `extern` or `export` that does not fit a C call
+	ErrUndeclaredEffect Code = "E0010" // an exported quotation without a declared stack effect
+	ErrUnknownType      Code = "E0011" // a type that is not `int`, `bool` or `ptr`
+	ErrUnsupported      Code = "E0012" // a feature that the selected backend cannot build
+	ErrInvalidOption    Code = "E0013" // an option of the compilation that has no meaning
+	ErrRecursiveMacro   Code = "E0014" // a macro that expands into itself
+	ErrStackUnderflow   Code = "E0101" // an intrinsic that needs more values than the stack holds
+	ErrTypeMismatch     Code = "E0102" // an intrinsic applied to values of the wrong type
+	ErrBranchMismatch   Code = "E0103" // branches of an `if` that leave different stacks
+	ErrLoopChangesStack Code = "E0104" // the body of a `for` that changes the stack
+	ErrEffectMismatch   Code = "E0105" // code that does not match a declared stack effect
+	WarnUnusedBinding   Code = "W0001" // a `let` binding that is never used
+)
+
+// Diagnostic is a problem found in the source, the notes point at the
+// locations related to it and help shows how the construct should look
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Loc      Location
+	Message  string
+	Notes    []Diagnostic
+	Help     string
+}
+
+// notef attaches a note at loc to the diagnostic
+func (d *Diagnostic) notef(loc Location, format string, args ...any) *Diagnostic {
+	d.Notes = append(d.Notes, Diagnostic{Severity: SeverityNote, Loc: loc, Message: fmt.Sprintf(format, args...)})
+	return d
+}
+
+// help attaches an example of the correct syntax to the diagnostic
+func (d *Diagnostic) help(usage []any) *Diagnostic {
+	d.Help = fmt.Sprint(usage...)
+	return d
+}
+
+// Diagnostics collects the problems of a compilation, so that parsing and
+// checking can go on after an error and everything is reported at once
+type Diagnostics struct {
+	list []*Diagnostic
+	// lines of the source files, to show the code a diagnostic points at
+	sources map[string][]string
+	// highlight the report with ANSI escape codes
+	Color bool
+}
+
+func (ds *Diagnostics) addSource(filePath string, content string) {
+	if ds.sources == nil {
+		ds.sources = make(map[string][]string)
+	}
+	ds.sources[filePath] = strings.Split(content, "\n")
+}
+
+func (ds *Diagnostics) add(severity Severity, loc Location, code Code, format string, args ...any) *Diagnostic {
+	d := &Diagnostic{Severity: severity, Code: code, Loc: loc, Message: fmt.Sprintf(format, args...)}
+	ds.list = append(ds.list, d)
+	return d
+}
+
+func (ds *Diagnostics) errorf(loc Location, code Code, format string, args ...any) *Diagnostic {
+	return ds.add(SeverityError, loc, code, format, args...)
+}
+
+func (ds *Diagnostics) warningf(loc Location, code Code, format string, args ...any) *Diagnostic {
+	return ds.add(SeverityWarning, loc, code, format, args...)
+}
+
+func (ds *Diagnostics) count(severity Severity) int {
+	n := 0
+	for _, d := range ds.list {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (ds *Diagnostics) hasErrors() bool {
+	return ds.count(SeverityError) > 0
+}
+
+func locationLess(a, b Location) bool {
+	if a.FilePath != b.FilePath {
+		return a.FilePath < b.FilePath
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Col < b.Col
+}
+
+// sorted orders the diagnostics by location and drops the duplicates that
+// come from checking the body of a macro at every place it is expanded
+func (ds *Diagnostics) sorted() []*Diagnostic {
+	list := append([]*Diagnostic(nil), ds.list...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return locationLess(list[i].Loc, list[j].Loc)
+	})
+	var unique []*Diagnostic
+	seen := make(map[string]bool)
+	for _, d := range list {
+		key := fmt.Sprintf("%v|%v|%v|%v", d.Loc, d.Severity, d.Code, d.Message)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, d)
+	}
+	return unique
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %v", n, word)
+	}
+	return fmt.Sprintf("%v %vs", n, word)
+}
+
+// report writes the diagnostics sorted by location, with the source line
+// they point at, followed by how many errors and warnings there are,
+// nothing is written without diagnostics
+func (ds *Diagnostics) report(w io.Writer) {
+	list := ds.sorted()
+	if len(list) == 0 {
+		return
+	}
+	errors, warnings := 0, 0
+	for _, d := range list {
+		ds.writeDiagnostic(w, d)
+		switch d.Severity {
+		case SeverityError:
+			errors++
+		case SeverityWarning:
+			warnings++
+		}
+	}
+	fmt.Fprintln(w, ds.paint(ansiBold, fmt.Sprintf("%v, %v", plural(errors, "error"), plural(warnings, "warning"))))
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiCyan   = "\x1b[1;36m"
+	ansiBlue   = "\x1b[1;34m"
+	ansiGreen  = "\x1b[1;32m"
+)
+
+var severityColor = map[Severity]string{
+	SeverityError:   ansiRed,
+	SeverityWarning: ansiYellow,
+	SeverityNote:    ansiCyan,
+}
+
+func (ds *Diagnostics) paint(color string, text string) string {
+	if !ds.Color {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+// sourceLine returns the line that loc points at
+func (ds *Diagnostics) sourceLine(loc Location) (string, bool) {
+	lines, found := ds.sources[loc.FilePath]
+	if !found || loc.Line == 0 || int(loc.Line) > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[loc.Line-1], "\r"), true
+}
+
+// span returns the column after the word at loc, every token is a word
+// delimited by whitespace so it ends at the next space. Like the columns of
+// the locations it counts bytes
+func (ds *Diagnostics) span(loc Location) uint {
+	line, found := ds.sourceLine(loc)
+	if !found || loc.Col == 0 || int(loc.Col) > len(line) {
+		return loc.Col
+	}
+	word := line[loc.Col-1:]
+	if end := strings.IndexFunc(word, unicode.IsSpace); end >= 0 {
+		word = word[:end]
+	}
+	return loc.Col + uint(len(word))
+}
+
+func (ds *Diagnostics) writeDiagnostic(w io.Writer, d *Diagnostic) {
+	gutter := len(fmt.Sprint(d.Loc.Line))
+	for _, note := range d.Notes {
+		gutter = max(gutter, len(fmt.Sprint(note.Loc.Line)))
+	}
+	color := severityColor[d.Severity]
+	fmt.Fprintf(w, "%v%v\n", ds.paint(color, fmt.Sprintf("%v[%v]", d.Severity, d.Code)), ds.paint(ansiBold, ": "+d.Message))
+	ds.writeExcerpt(w, d.Loc, color, gutter)
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%v%v\n", ds.paint(ansiCyan, "note"), ds.paint(ansiBold, ": "+note.Message))
+		ds.writeExcerpt(w, note.Loc, ansiCyan, gutter)
+	}
+	if d.Help != "" {
+		lines := strings.Split(d.Help, "\n")
+		fmt.Fprintf(w, "%v: %v\n", ds.paint(ansiGreen, "help"), strings.TrimRight(lines[0], " "))
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "     %v\n", strings.TrimRight(line, " "))
+		}
+	}
+}
+
+// writeExcerpt shows the location and the source line of loc, with the
+// word at loc underlined
+func (ds *Diagnostics) writeExcerpt(w io.Writer, loc Location, color string, gutter int) {
+	pad := strings.Repeat(" ", gutter)
+	// diagnostics about the whole file, like invalid options, have no line
+	if loc.Line == 0 {
+		fmt.Fprintf(w, "%v%v %v\n", pad, ds.paint(ansiBlue, "-->"), loc.FilePath)
+		return
+	}
+	fmt.Fprintf(w, "%v%v %v:%v:%v\n", pad, ds.paint(ansiBlue, "-->"), loc.FilePath, loc.Line, loc.Col)
+	line, found := ds.sourceLine(loc)
+	if !found {
+		return
+	}
+	bar := ds.paint(ansiBlue, "|")
+	fmt.Fprintf(w, "%v %v\n", pad, bar)
+	fmt.Fprintf(w, "%v %v %v\n", ds.paint(ansiBlue, fmt.Sprintf("%*v", gutter, loc.Line)), bar, line)
+	// keep the tabs in front of the word, so the carets line up with it
+	var indent strings.Builder
+	for i, r := range line {
+		if uint(i) >= loc.Col-1 {
+			break
+		}
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	// one caret for every character of the word
+	width := 0
+	if end := ds.span(loc); end > loc.Col {
+		width = utf8.RuneCountInString(line[loc.Col-1 : end-1])
+	}
+	carets := strings.Repeat("^", max(1, width))
+	fmt.Fprintf(w, "%v %v %v%v\n", pad, bar, indent.String(), ds.paint(color, carets))
+}
+
+type jsonDiagnostic struct {
+	Severity string           `json:"severity"`
+	Code     Code             `json:"code,omitempty"`
+	File     string           `json:"file"`
+	Line     uint             `json:"line"`
+	Col      uint             `json:"col"`
+	EndCol   uint             `json:"end_col"`
+	Message  string           `json:"message"`
+	Notes    []jsonDiagnostic `json:"notes,omitempty"`
+	Help     string           `json:"help,omitempty"`
+}
+
+func (ds *Diagnostics) toJSON(d *Diagnostic) jsonDiagnostic {
+	j := jsonDiagnostic{
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		File:     d.Loc.FilePath,
+		Line:     d.Loc.Line,
+		Col:      d.Loc.Col,
+		EndCol:   ds.span(d.Loc),
+		Message:  d.Message,
+		Help:     d.Help,
+	}
+	for i := range d.Notes {
+		j.Notes = append(j.Notes, ds.toJSON(&d.Notes[i]))
+	}
+	return j
+}
+
+// reportJSON writes the diagnostics sorted by location and their counts as
+// a single JSON object, which is written even when there are no diagnostics
+func (ds *Diagnostics) reportJSON(w io.Writer) error {
+	report := struct {
+		Diagnostics []jsonDiagnostic `json:"diagnostics"`
+		Errors      int              `json:"errors"`
+		Warnings    int              `json:"warnings"`
+	}{Diagnostics: []jsonDiagnostic{}}
+	for _, d := range ds.sorted() {
+		report.Diagnostics = append(report.Diagnostics, ds.toJSON(d))
+		switch d.Severity {
+		case SeverityError:
+			report.Errors++
+		case SeverityWarning:
+			report.Warnings++
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
+
+// HasErrors reports whether any of diags is an error, a compilation only
+// has a result without errors
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func newDiagnostics(diags []Diagnostic, filePath string, src string, color bool) *Diagnostics {
+	ds := &Diagnostics{Color: color}
+	ds.addSource(filePath, src)
+	for i := range diags {
+		ds.list = append(ds.list, &diags[i])
+	}
+	return ds
+}
+
+// WriteDiagnostics writes diags with the lines of src they point at,
+// followed by how many errors and warnings there are. Nothing is written
+// without diagnostics, color highlights the report with ANSI escape codes
+func WriteDiagnostics(w io.Writer, diags []Diagnostic, filePath string, src string, color bool) {
+	newDiagnostics(diags, filePath, src, color).report(w)
+}
+
+// WriteDiagnosticsJSON writes diags and their counts as a single JSON object
+func WriteDiagnosticsJSON(w io.Writer, diags []Diagnostic, filePath string, src string) error {
+	return newDiagnostics(diags, filePath, src, false).reportJSON(w)
+}
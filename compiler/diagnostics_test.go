@@ -0,0 +1,142 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteDiagnosticsJSON(t *testing.T) {
+	src := "macro m\n  [ 1\nend\nextern foo\n"
+	_, diags := Compile(src, Options{FilePath: "test.dodo"})
+	var out bytes.Buffer
+	if err := WriteDiagnosticsJSON(&out, diags, "test.dodo", src); err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]any
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %v: %v", out.String(), err)
+	}
+	if report["errors"] != 3.0 || report["warnings"] != 0.0 {
+		t.Errorf("got %v errors and %v warnings, want 3 and 0", report["errors"], report["warnings"])
+	}
+	got := report["diagnostics"].([]any)
+	want := []map[string]any{
+		{
+			"severity": "error", "code": "E0003", "file": "test.dodo", "line": 2.0, "col": 3.0, "end_col": 4.0,
+			"message": "unclosed quotation inside of macro definition, expected `]`",
+			"notes": []any{map[string]any{
+				"severity": "note", "file": "test.dodo", "line": 3.0, "col": 1.0, "end_col": 4.0,
+				"message": "macro `m` ends here",
+			}},
+		},
+		{
+			"severity": "error", "code": "E0004", "file": "test.dodo", "line": 4.0, "col": 1.0, "end_col": 7.0,
+			"message": "expected a name followed by `(`",
+			"help":    fmt.Sprint(externUsage...),
+		},
+		{
+			"severity": "error", "code": "E0001", "file": "test.dodo", "line": 4.0, "col": 8.0, "end_col": 11.0,
+			"message": "undefined word `foo`",
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v diagnostics, want %v\n%v", len(got), len(want), out.String())
+	}
+	for i := range want {
+		g, _ := json.Marshal(got[i])
+		w, _ := json.Marshal(want[i])
+		if !bytes.Equal(g, w) {
+			t.Errorf("got diagnostic\n%s\nwant\n%s", g, w)
+		}
+	}
+}
+
+func TestWriteDiagnosticsJSONEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDiagnosticsJSON(&out, nil, "test.dodo", ""); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"diagnostics":[],"errors":0,"warnings":0}` + "\n"; out.String() != want {
+		t.Errorf("got %v, want %v", out.String(), want)
+	}
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"ascii",
+			"1 print foo\n",
+			"error[E0001]: undefined word `foo`\n" +
+				" --> test.dodo:1:9\n" +
+				"  |\n" +
+				"1 | 1 print foo\n" +
+				"  |         ^^^\n",
+		},
+		{
+			// the columns count bytes, the carets characters
+			"multi-byte characters",
+			"macro é 1 end\né print ünknown\n",
+			"error[E0001]: undefined word `ünknown`\n" +
+				" --> test.dodo:2:10\n" +
+				"  |\n" +
+				"2 | é print ünknown\n" +
+				"  |         ^^^^^^^\n",
+		},
+		{
+			"tabs",
+			"\t1 print\tfoo\n",
+			"error[E0001]: undefined word `foo`\n" +
+				" --> test.dodo:1:10\n" +
+				"  |\n" +
+				"1 | \t1 print\tfoo\n" +
+				"  | \t       \t^^^\n",
+		},
+		{
+			"notes",
+			"macro m\n  [ 1\nend\n",
+			"error[E0003]: unclosed quotation inside of macro definition, expected `]`\n" +
+				" --> test.dodo:2:3\n" +
+				"  |\n" +
+				"2 |   [ 1\n" +
+				"  |   ^\n" +
+				"note: macro `m` ends here\n" +
+				" --> test.dodo:3:1\n" +
+				"  |\n" +
+				"3 | end\n" +
+				"  | ^^^\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Compile(test.src, Options{FilePath: "test.dodo"})
+			var out bytes.Buffer
+			WriteDiagnostics(&out, diags, "test.dodo", test.src, false)
+			want := test.want + "1 error, 0 warnings\n"
+			if out.String() != want {
+				t.Errorf("got\n%v\nwant\n%v", out.String(), want)
+			}
+			if strings.Contains(out.String(), "\x1b[") {
+				t.Errorf("escape codes without color")
+			}
+		})
+	}
+}
+
+func TestWriteDiagnosticsColor(t *testing.T) {
+	src := "1 print foo\n"
+	_, diags := Compile(src, Options{FilePath: "test.dodo"})
+	var out bytes.Buffer
+	WriteDiagnostics(&out, diags, "test.dodo", src, true)
+	for _, want := range []string{ansiRed + "error[E0001]" + ansiReset, ansiBlue + "-->" + ansiReset, ansiRed + "^^^" + ansiReset} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	elfBase        = 0x400000
+	elfPageSize    = 0x1000
+	elfHeaderSize  = 64
+	elfPhdrSize    = 56
+	elfPhdrCount   = 2
+	elfHeadersSize = elfHeaderSize + elfPhdrCount*elfPhdrSize
+)
+
+// elfImage is a static executable with a text segment and a data segment
+// that the bss is appended to
+type elfImage struct {
+	entry    int64
+	text     []byte
+	textAddr int64
+	data     []byte
+	dataAddr int64
+	bssAddr  int64
+	bssSize  int64
+}
+
+type elfHeader struct {
+	Ident     [16]byte
+	Type      uint16
+	Machine   uint16
+	Version   uint32
+	Entry     uint64
+	Phoff     uint64
+	Shoff     uint64
+	Flags     uint32
+	Ehsize    uint16
+	Phentsize uint16
+	Phnum     uint16
+	Shentsize uint16
+	Shnum     uint16
+	Shstrndx  uint16
+}
+
+type elfPhdr struct {
+	Type   uint32
+	Flags  uint32
+	Offset uint64
+	Vaddr  uint64
+	Paddr  uint64
+	Filesz uint64
+	Memsz  uint64
+	Align  uint64
+}
+
+const (
+	elfPtLoad = 1
+	elfPfX    = 1
+	elfPfW    = 2
+	elfPfR    = 4
+)
+
+// writeElf encodes image as an x86-64 linux executable without section headers,
+// the segments are mapped at the same offsets from elfBase as they have in the file
+func writeElf(image elfImage) []byte {
+	textOffset := image.textAddr - elfBase
+	dataOffset := image.dataAddr - elfBase
+	assert(textOffset == elfHeadersSize, "text has to follow the headers in writeElf")
+	assert(dataOffset%elfPageSize == 0, "data has to be page aligned in writeElf")
+
+	header := elfHeader{
+		Ident:     [16]byte{0x7f, 'E', 'L', 'F', 2, 1, 1},
+		Type:      2, // ET_EXEC
+		Machine:   0x3e,
+		Version:   1,
+		Entry:     uint64(image.entry),
+		Phoff:     elfHeaderSize,
+		Ehsize:    elfHeaderSize,
+		Phentsize: elfPhdrSize,
+		Phnum:     elfPhdrCount,
+	}
+	phdrs := [elfPhdrCount]elfPhdr{
+		{
+			Type:   elfPtLoad,
+			Flags:  elfPfR | elfPfX,
+			Offset: 0,
+			Vaddr:  elfBase,
+			Paddr:  elfBase,
+			Filesz: uint64(textOffset) + uint64(len(image.text)),
+			Memsz:  uint64(textOffset) + uint64(len(image.text)),
+			Align:  elfPageSize,
+		},
+		{
+			Type:   elfPtLoad,
+			Flags:  elfPfR | elfPfW,
+			Offset: uint64(dataOffset),
+			Vaddr:  uint64(image.dataAddr),
+			Paddr:  uint64(image.dataAddr),
+			Filesz: uint64(len(image.data)),
+			Memsz:  uint64(image.bssAddr-image.dataAddr) + uint64(image.bssSize),
+			Align:  elfPageSize,
+		},
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, phdrs)
+	buf.Write(image.text)
+	buf.Write(make([]byte, dataOffset-int64(buf.Len())))
+	buf.Write(image.data)
+	return buf.Bytes()
+}
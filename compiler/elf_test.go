@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestElfHeaders(t *testing.T) {
+	exe, err := Assemble("section .text\n_start:\nret\nsection .data\nmsg: db \"hi\", 10\nsection .bss\nbuf: resq 4\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, phdrs := readElf(t, exe)
+	textAddr := uint64(elfBase + elfHeadersSize)
+	dataAddr := uint64(elfBase + elfPageSize)
+	wantHeader := elfHeader{
+		Ident:     [16]byte{0x7f, 'E', 'L', 'F', 2, 1, 1},
+		Type:      2,
+		Machine:   0x3e,
+		Version:   1,
+		Entry:     textAddr,
+		Phoff:     elfHeaderSize,
+		Ehsize:    elfHeaderSize,
+		Phentsize: elfPhdrSize,
+		Phnum:     elfPhdrCount,
+	}
+	if header != wantHeader {
+		t.Errorf("got header %+v, want %+v", header, wantHeader)
+	}
+	wantPhdrs := [elfPhdrCount]elfPhdr{
+		// the text segment maps the headers along with the single `ret`
+		{Type: elfPtLoad, Flags: elfPfR | elfPfX, Offset: 0, Vaddr: elfBase, Paddr: elfBase, Filesz: elfHeadersSize + 1, Memsz: elfHeadersSize + 1, Align: elfPageSize},
+		// the bss follows the 3 bytes of data at the next multiple of 8
+		{Type: elfPtLoad, Flags: elfPfR | elfPfW, Offset: elfPageSize, Vaddr: dataAddr, Paddr: dataAddr, Filesz: 3, Memsz: 8 + 4*8, Align: elfPageSize},
+	}
+	if phdrs != wantPhdrs {
+		t.Errorf("got program headers %+v, want %+v", phdrs, wantPhdrs)
+	}
+	if len(exe) != elfPageSize+3 {
+		t.Fatalf("got %v bytes, want %v", len(exe), elfPageSize+3)
+	}
+	if exe[elfHeadersSize] != 0xc3 || !bytes.Equal(exe[elfPageSize:], []byte("hi\n")) {
+		t.Errorf("got text % x and data %q", exe[elfHeadersSize], exe[elfPageSize:])
+	}
+}
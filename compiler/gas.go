@@ -0,0 +1,172 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The gas backend rewrites the nasm source emitted by compileProgram into
+// GNU as syntax, it keeps the intel operand order with `.intel_syntax noprefix`
+// so that the header, the codegen and the .bss layout stay the same
+
+func gasExpr(expr asmExpr) string {
+	var sb strings.Builder
+	for i, term := range expr {
+		switch {
+		case term.negative:
+			sb.WriteString("-")
+		case i > 0:
+			sb.WriteString("+")
+		}
+		switch term.symbol {
+		case "":
+			sb.WriteString(strconv.FormatInt(term.value, 10))
+		case "$":
+			sb.WriteString(".")
+		default:
+			sb.WriteString(term.symbol)
+		}
+	}
+	return sb.String()
+}
+
+var gasSizes = map[int]string{1: "byte ptr ", 2: "word ptr ", 4: "dword ptr ", 8: "qword ptr "}
+
+func gasOperand(mnemonic string, text string, op asmOperand) string {
+	switch op.kind {
+	case operandReg:
+		return text
+	case operandMem:
+		var regs []string
+		for _, reg := range []*x86Reg{op.base, op.index} {
+			if reg != nil {
+				regs = append(regs, registerName(*reg))
+			}
+		}
+		address := strings.Join(regs, "+")
+		if len(op.expr) > 0 {
+			// a negative displacement brings its own sign
+			if expr := gasExpr(op.expr); address == "" || strings.HasPrefix(expr, "-") {
+				address += expr
+			} else {
+				address += "+" + expr
+			}
+		}
+		return gasSizes[op.size] + "[" + address + "]"
+	}
+	// jump targets are plain symbols, anywhere else a symbol is an immediate
+	if op.expr.symbolic() && !strings.HasPrefix(mnemonic, "j") && mnemonic != "call" {
+		return "OFFSET " + gasExpr(op.expr)
+	}
+	return gasExpr(op.expr)
+}
+
+func registerName(reg x86Reg) string {
+	for name, r := range x86Registers {
+		if r == reg {
+			return name
+		}
+	}
+	assert(false, "unknown register in registerName")
+	return ""
+}
+
+// gasString escapes s for `.ascii`, nasm strings have no escapes but gas ones do
+func gasString(s string) string {
+	return strings.ReplaceAll(s, `\`, `\\`)
+}
+
+// translateToGas returns the GNU as equivalent of the nasm source
+func translateToGas(source string) (string, error) {
+	var a assembler
+	out := []string{".intel_syntax noprefix"}
+	scope := ""
+	// numbers of the source files named by `%line`
+	files := make(map[string]int)
+	for i, text := range strings.Split(source, "\n") {
+		line := i + 1
+		if comment := strings.TrimSpace(text); strings.HasPrefix(comment, ";") {
+			out = append(out, "#"+comment[1:])
+			continue
+		}
+		if fields := strings.Fields(text); len(fields) >= 3 && fields[0] == "%line" {
+			path := strings.Join(fields[2:], " ")
+			if _, ok := files[path]; !ok {
+				files[path] = len(files) + 1
+				out = append(out, fmt.Sprintf(".file %v \"%v\"", files[path], gasString(path)))
+			}
+			srcLine, _, _ := strings.Cut(fields[1], "+")
+			out = append(out, fmt.Sprintf(".loc %v %v", files[path], srcLine))
+			continue
+		}
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" || strings.HasPrefix(text, "%") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch strings.ToLower(fields[0]) {
+		case "bits":
+			continue
+		case "global":
+			out = append(out, ".globl "+fields[1])
+			continue
+		case "extern":
+			out = append(out, ".extern "+fields[1])
+			continue
+		case "section":
+			if len(fields) > 2 && fields[len(fields)-1] == "progbits" {
+				// a section without flags like `.note.GNU-stack`
+				out = append(out, fmt.Sprintf(".section %v,\"\",@progbits", fields[1]))
+			} else {
+				out = append(out, ".section "+fields[1])
+			}
+			continue
+		}
+		if len(fields) >= 3 && fields[1] == "equ" {
+			expr, err := a.parseExpr(strings.Join(fields[2:], " "), scope)
+			if err != nil {
+				return "", fmt.Errorf("%v: %v", line, err)
+			}
+			out = append(out, fmt.Sprintf(".set %v, %v", fields[0], gasExpr(expr)))
+			continue
+		}
+		if label, rest, found := strings.Cut(text, ":"); found && !strings.ContainsAny(label, " \t\"'[") {
+			if !strings.HasPrefix(label, ".") {
+				scope = label
+			}
+			out = append(out, a.qualify(label, scope)+":")
+			if text = strings.TrimSpace(rest); text == "" {
+				continue
+			}
+		}
+		mnemonic, rest, _ := strings.Cut(text, " ")
+		mnemonic = strings.ToLower(mnemonic)
+		operands := splitOperands(rest)
+		switch mnemonic {
+		case "db":
+			for _, op := range operands {
+				if strings.HasPrefix(op, `"`) || strings.HasPrefix(op, "'") {
+					out = append(out, fmt.Sprintf(".ascii \"%v\"", gasString(op[1:len(op)-1])))
+				} else {
+					out = append(out, ".byte "+op)
+				}
+			}
+		case "resb":
+			out = append(out, ".skip "+strings.TrimSpace(rest))
+		case "resq":
+			out = append(out, ".skip 8*"+strings.TrimSpace(rest))
+		default:
+			var rendered []string
+			for _, s := range operands {
+				op, err := a.parseOperand(s, scope)
+				if err != nil {
+					return "", fmt.Errorf("%v: %v", line, err)
+				}
+				rendered = append(rendered, gasOperand(mnemonic, s, op))
+			}
+			out = append(out, strings.TrimSpace(mnemonic+" "+strings.Join(rendered, ", ")))
+		}
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
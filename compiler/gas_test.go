@@ -0,0 +1,60 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTranslateToGas(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"intel operand order", "mov rax, rbx", "mov rax, rbx"},
+		{"sized memory operand", "mov qword [r15], rax", "mov qword ptr [r15], rax"},
+		{"byte memory operand", "mov byte [print_buffer + rbx], dl", "mov byte ptr [rbx+print_buffer], dl"},
+		{"unsized memory operand", "mov rax, [r15+8]", "mov rax, [r15+8]"},
+		{"negative displacement", "mov rax, [rbx-8]", "mov rax, [rbx-8]"},
+		{"index register", "mov rax, [rbx+rcx]", "mov rax, [rbx+rcx]"},
+		{"symbol as an immediate", "mov rax, quote_0", "mov rax, OFFSET quote_0"},
+		{"jump target", "jmp main_b1", "jmp main_b1"},
+		{"call target", "call print", "call print"},
+		{"immediate", "add rax, -8", "add rax, -8"},
+		{"local label", "print:\n.L1:\njmp .L1", "print:\nprint.L1:\njmp print.L1"},
+		{"db", "msg: db \"a\\b\", 10", "msg:\n.ascii \"a\\\\b\"\n.byte 10"},
+		{"resb", "print_buffer: resb 22", "print_buffer:\n.skip 22"},
+		{"resq", "ret_stack: resq 1024", "ret_stack:\n.skip 8*1024"},
+		{"equ", "msg: db 1\nlen equ $ - msg", "msg:\n.byte 1\n.set len, .-msg"},
+		{
+			"line directives",
+			"%line 3+0 test.dodo\nret\n%line 4+0 test.dodo\n%line 1+0 other.dodo",
+			".file 1 \"test.dodo\"\n.loc 1 3\nret\n.loc 1 4\n.file 2 \"other.dodo\"\n.loc 2 1",
+		},
+		{"comment", "; -- Plus --", "# -- Plus --"},
+		{"trailing comment", "ret ; done", "ret"},
+		{"global", "global _start", ".globl _start"},
+		{"extern", "extern c_add", ".extern c_add"},
+		{"bits", "BITS 64\nret", "ret"},
+		{"section", "section .bss", ".section .bss"},
+		{"section without flags", "section .note.GNU-stack noalloc noexec nowrite progbits", ".section .note.GNU-stack,\"\",@progbits"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateToGas(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := ".intel_syntax noprefix\n" + test.want + "\n"; got != want {
+				t.Errorf("got\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestTranslateToGasErrors(t *testing.T) {
+	_, err := translateToGas("ret\nmov rax, [rbx")
+	if err == nil || !strings.HasPrefix(err.Error(), "2: ") {
+		t.Errorf("got error %v, want one on line 2", err)
+	}
+}
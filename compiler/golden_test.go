@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the emitted code")
+
+// goldenExamples are the examples whose emitted code is compared with the
+// golden files of every backend, the programs in testdata/golden cover what
+// the examples do not
+var goldenExamples = []string{"assert", "if_else", "let", "loop", "quote"}
+
+// goldenBackends are the backends whose output cannot be run on every
+// machine, so the code they emit is compared with the golden files in
+// testdata/<dir>
+var goldenBackends = []struct {
+	dir  string
+	ext  string
+	opts Options
+}{
+	{"arm64", ".s", Options{Emit: "asm", Arch: "arm64"}},
+	{"llvm", ".ll", Options{Emit: "llvm"}},
+	{"wasm", ".wat", Options{Emit: "wat"}},
+}
+
+func TestGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("..", "testdata", "golden", "*.dodo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range goldenExamples {
+		sources = append(sources, filepath.Join("..", "examples", name+".dodo"))
+	}
+	for _, backend := range goldenBackends {
+		for _, path := range sources {
+			name := strings.TrimSuffix(filepath.Base(path), ".dodo")
+			t.Run(backend.dir+"/"+name, func(t *testing.T) {
+				src, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts := backend.opts
+				// the golden files were built next to the program, so the
+				// locations in runtime messages only hold its name
+				opts.FilePath = filepath.Base(path)
+				result, diags := Compile(string(src), opts)
+				if HasErrors(diags) {
+					t.Fatalf("unexpected diagnostics %v", diags)
+				}
+				golden := filepath.Join("..", "testdata", backend.dir, name+backend.ext)
+				if *update {
+					if err := os.WriteFile(golden, []byte(result.Code), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Code != string(want) {
+					t.Errorf("emitted code differs from %v, run `go test ./compiler -run TestGolden -update` to accept it", golden)
+				}
+			})
+		}
+	}
+}
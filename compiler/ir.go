@@ -0,0 +1,348 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Op is an instruction of the intermediate representation, control flow
+// is not part of it as it is expressed by the terminators of the blocks
+type Op uint
+
+const (
+	OpPushInt   Op = iota // Operand: value
+	OpPushBool            // Operand: 0 or 1
+	OpPushVar             // Operand: offset into vars_buffer
+	OpPushQuote           // Operand: id of the quote routine
+	OpPlus
+	OpSub
+	OpMult
+	OpDivMod
+	OpPrint
+	OpSwap
+	OpDup
+	OpDrop
+	OpRot
+	OpGt
+	OpGe
+	OpLt
+	OpLe
+	OpEq
+	OpSyscall1
+	OpSyscall3
+	OpRead
+	OpWrite
+	OpCall
+	OpLet    // Operand: number of bindings
+	OpLetEnd // Operand: number of bindings
+	OpLocal  // Operand: slot of the binding
+	OpAssert
+	OpCallExtern // Operand: index of the function in Program.Externs
+	OpCount
+)
+
+type Instr struct {
+	Op      Op
+	Operand uint64
+	Loc     Location
+	// call site of the outermost macro the instruction was expanded from,
+	// zero outside of macros
+	Site Location
+}
+
+type TermKind uint
+
+const (
+	// TermJump continues at Then
+	TermJump TermKind = iota
+	// TermBranch pops a bool and continues at Then when it is true and at Else otherwise
+	TermBranch
+	// TermReturn leaves the routine, which exits the program for the main routine
+	TermReturn
+)
+
+type Term struct {
+	Kind TermKind
+	Then int
+	Else int
+	Loc  Location
+	Site Location // same as Instr.Site
+}
+
+// Block is a basic block, control only enters at the top and leaves through Term
+type Block struct {
+	ID       int
+	Instrs   []Instr
+	Term     Term
+	LoopHead bool     // target of the back edge of a `for`
+	Loc      Location // location of the `for` of a loop head
+}
+
+// Routine is the main program or the body of a quote, Blocks[0] is the entry
+type Routine struct {
+	Name   string
+	Blocks []*Block
+	Loc    Location
+	// C symbol of an exported quote and its declared stack effect
+	Export string
+	Effect StackEffect
+}
+
+type Program struct {
+	Main    Routine
+	Quotes  []Routine
+	Externs []Extern
+}
+
+type irBlock struct {
+	Token     Token
+	Branch    *Block // block that ends with the `if` or `do` branch
+	ElseJump  *Block // block that jumps over the else branch
+	LoopHead  *Block
+	FrameSize uint64
+}
+
+type irBuilder struct {
+	c         *compiler
+	strTokens []StringToken
+	routine   *Routine
+	current   *Block
+	// open blocks by the id the parser gave them
+	blocks map[int]*irBlock
+	// call site of the macro being expanded
+	site Location
+}
+
+func (b *irBuilder) newBlock() *Block {
+	block := &Block{ID: len(b.routine.Blocks)}
+	b.routine.Blocks = append(b.routine.Blocks, block)
+	return block
+}
+
+// openBlock finds the block that a keyword continues or closes
+func (b *irBuilder) openBlock(token Token, opening ...TokenType) *irBlock {
+	block, found := b.blocks[token.Block]
+	assert(found && slices.Contains(opening, block.Token.Type), "keyword without a matching block in buildIR, this should have been caught by the parser")
+	return block
+}
+
+func (b *irBuilder) emit(op Op, operand uint64, loc Location) {
+	b.current.Instrs = append(b.current.Instrs, Instr{Op: op, Operand: operand, Loc: loc, Site: b.site})
+}
+
+// buildIR lowers the parsed program into basic blocks with resolved jump targets,
+// macros are expanded in place, the tokens are expected to be type checked
+func (c *compiler) buildIR(strTokens []StringToken, tokens []Token) Program {
+	var program Program
+	program.Main = c.buildRoutine(strTokens, "main", tokens, Location{})
+	for id, quote := range c.quotes {
+		routine := c.buildRoutine(strTokens, fmt.Sprintf("quote_%v", id), quote.Body, quote.Loc)
+		routine.Export = quote.Export
+		routine.Effect = quote.Effect
+		program.Quotes = append(program.Quotes, routine)
+	}
+	program.Externs = c.externs
+	return program
+}
+
+func (c *compiler) buildRoutine(strTokens []StringToken, name string, tokens []Token, loc Location) Routine {
+	routine := Routine{Name: name, Loc: loc}
+	b := irBuilder{c: c, strTokens: strTokens, routine: &routine, blocks: map[int]*irBlock{}}
+	b.current = b.newBlock()
+	b.build(tokens)
+	assert(len(b.blocks) == 0, "unclosed block in buildRoutine, this should have been caught by the parser")
+	b.current.Term = Term{Kind: TermReturn}
+	return routine
+}
+
+func (b *irBuilder) build(tokens []Token) {
+	assert(TokenCount == 41, "Exhaustive switch case for buildIR")
+	for _, token := range tokens {
+		loc := token.Loc
+		switch token.Type {
+		case TokenInt:
+			b.emit(OpPushInt, token.Operand, loc)
+		case TokenTrue:
+			b.emit(OpPushBool, 1, loc)
+		case TokenFalse:
+			b.emit(OpPushBool, 0, loc)
+		case TokenPlus:
+			b.emit(OpPlus, 0, loc)
+		case TokenSub:
+			b.emit(OpSub, 0, loc)
+		case TokenMult:
+			b.emit(OpMult, 0, loc)
+		case TokenDivMod:
+			b.emit(OpDivMod, 0, loc)
+		case TokenPrint:
+			b.emit(OpPrint, 0, loc)
+		case TokenSwap:
+			b.emit(OpSwap, 0, loc)
+		case TokenDup:
+			b.emit(OpDup, 0, loc)
+		case TokenDrop:
+			b.emit(OpDrop, 0, loc)
+		case TokenRot:
+			b.emit(OpRot, 0, loc)
+		case TokenGt:
+			b.emit(OpGt, 0, loc)
+		case TokenGe:
+			b.emit(OpGe, 0, loc)
+		case TokenLt:
+			b.emit(OpLt, 0, loc)
+		case TokenLe:
+			b.emit(OpLe, 0, loc)
+		case TokenEq:
+			b.emit(OpEq, 0, loc)
+		case TokenSyscall1:
+			b.emit(OpSyscall1, 0, loc)
+		case TokenSyscall3:
+			b.emit(OpSyscall3, 0, loc)
+		case TokenRead:
+			b.emit(OpRead, 0, loc)
+		case TokenWrite:
+			b.emit(OpWrite, 0, loc)
+		case TokenQuote:
+			b.emit(OpPushQuote, token.Operand, loc)
+		case TokenCall:
+			b.emit(OpCall, 0, loc)
+		case TokenLocal:
+			b.emit(OpLocal, token.Operand, loc)
+		case TokenAssert:
+			b.emit(OpAssert, 0, loc)
+		case TokenLet:
+			b.emit(OpLet, token.Operand, loc)
+			b.blocks[token.Block] = &irBlock{Token: token, FrameSize: token.Operand}
+		case TokenIf:
+			then := b.newBlock()
+			b.current.Term = Term{Kind: TermBranch, Then: then.ID, Loc: loc, Site: b.site}
+			b.blocks[token.Block] = &irBlock{Token: token, Branch: b.current}
+			b.current = then
+		case TokenElse:
+			block := b.openBlock(token, TokenIf)
+			elseBlock := b.newBlock()
+			block.Branch.Term.Else = elseBlock.ID
+			block.ElseJump = b.current
+			b.current = elseBlock
+		case TokenFor:
+			head := b.newBlock()
+			head.LoopHead = true
+			head.Loc = loc
+			b.current.Term = Term{Kind: TermJump, Then: head.ID, Loc: loc, Site: b.site}
+			b.blocks[token.Block] = &irBlock{Token: token, LoopHead: head}
+			b.current = head
+		case TokenDo:
+			block := b.openBlock(token, TokenFor)
+			body := b.newBlock()
+			b.current.Term = Term{Kind: TermBranch, Then: body.ID, Loc: loc, Site: b.site}
+			block.Branch = b.current
+			b.current = body
+		case TokenEnd:
+			block := b.openBlock(token, TokenIf, TokenFor, TokenLet)
+			delete(b.blocks, token.Block)
+			switch block.Token.Type {
+			case TokenIf:
+				end := b.newBlock()
+				b.current.Term = Term{Kind: TermJump, Then: end.ID, Loc: loc, Site: b.site}
+				if block.ElseJump != nil {
+					block.ElseJump.Term = Term{Kind: TermJump, Then: end.ID, Loc: loc, Site: b.site}
+				} else {
+					block.Branch.Term.Else = end.ID
+				}
+				b.current = end
+			case TokenFor:
+				exit := b.newBlock()
+				b.current.Term = Term{Kind: TermJump, Then: block.LoopHead.ID, Loc: loc, Site: b.site}
+				block.Branch.Term.Else = exit.ID
+				b.current = exit
+			case TokenLet:
+				b.emit(OpLetEnd, block.FrameSize, loc)
+			default:
+				assert(false, "unreachable block type in buildIR")
+			}
+		case TokenWord:
+			name := b.strTokens[token.Operand].Content
+			if id, found := b.c.lookupExtern(name); found {
+				b.emit(OpCallExtern, uint64(id), loc)
+			} else if macro, found := b.c.macros[name]; found {
+				if b.c.expanding[name] {
+					// a cycle through macros with a declared effect, which
+					// are not expanded by the type checker
+					b.c.reportRecursiveMacro(token, name, macro)
+					continue
+				}
+				b.c.expanding[name] = true
+				if b.site == (Location{}) {
+					b.site = loc
+					b.build(macro.Body)
+					b.site = Location{}
+				} else {
+					b.build(macro.Body)
+				}
+				delete(b.c.expanding, name)
+			} else if v, found := b.c.vars[name]; found {
+				b.emit(OpPushVar, v.Operand, loc)
+			} else {
+				assert(false, "undefined word in buildIR, this should have been caught by the parser")
+			}
+		case TokenMacroEnd:
+		case TokenMacro, TokenVar, TokenQuoteEnd, TokenIn, TokenBool, TokenPtr, TokenExtern, TokenExport:
+			assert(false, "token should have been removed in the parsing stage")
+		default:
+			assert(false, "buildIR unreachable")
+		}
+	}
+}
+
+var opStr = map[Op]string{
+	OpPushInt:    "push-int",
+	OpPushBool:   "push-bool",
+	OpPushVar:    "push-var",
+	OpPushQuote:  "push-quote",
+	OpPlus:       "+",
+	OpSub:        "-",
+	OpMult:       "*",
+	OpDivMod:     "divmod",
+	OpPrint:      "print",
+	OpSwap:       "swap",
+	OpDup:        "dup",
+	OpDrop:       "drop",
+	OpRot:        "rot",
+	OpGt:         ">",
+	OpGe:         ">=",
+	OpLt:         "<",
+	OpLe:         "<=",
+	OpEq:         "=",
+	OpSyscall1:   "syscall1",
+	OpSyscall3:   "syscall3",
+	OpRead:       "@",
+	OpWrite:      "!",
+	OpCall:       "call",
+	OpLet:        "let",
+	OpLetEnd:     "let-end",
+	OpLocal:      "local",
+	OpAssert:     "assert",
+	OpCallExtern: "call-extern",
+}
+
+func (r Routine) String() string {
+	assert(len(opStr) == int(OpCount), "Exhaustive opStr")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v:\n", r.Name)
+	for _, block := range r.Blocks {
+		fmt.Fprintf(&sb, "  b%v:\n", block.ID)
+		for _, instr := range block.Instrs {
+			fmt.Fprintf(&sb, "    %v %v\n", opStr[instr.Op], instr.Operand)
+		}
+		switch block.Term.Kind {
+		case TermJump:
+			fmt.Fprintf(&sb, "    jump b%v\n", block.Term.Then)
+		case TermBranch:
+			fmt.Fprintf(&sb, "    branch b%v b%v\n", block.Term.Then, block.Term.Else)
+		case TermReturn:
+			fmt.Fprintf(&sb, "    return\n")
+		}
+	}
+	return sb.String()
+}
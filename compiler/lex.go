@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"strings"
+	"unicode"
+)
+
+func lexFile(content string, filePath string) []StringToken {
+	var tokens []StringToken
+	var t StringToken
+	t.Loc.FilePath = filePath
+	bol := 0
+	lineNo := 0
+	start := 0
+	// word appends the word from start up to end, if there is one
+	word := func(end int) {
+		if end > start {
+			t.Content = content[start:end]
+			t.Loc.Col = uint(start - bol + 1)
+			t.Loc.Line = uint(lineNo + 1)
+			tokens = append(tokens, t)
+		}
+	}
+	for i := 0; i < len(content); i++ {
+		switch {
+		case unicode.IsSpace(rune(content[i])):
+			word(i)
+			if content[i] == '\n' {
+				lineNo++
+				bol = i + 1
+			}
+			start = i + 1
+		case strings.HasPrefix(content[i:], "//"):
+			word(i)
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			lineNo++
+			bol = i + 1
+			start = i + 1
+		}
+	}
+	word(len(content))
+	return tokens
+}
@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestLexFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"only whitespace", " \n\t\n", nil},
+		{"comment at the end without a newline", "// hi", nil},
+		{"single slash at the end", "1 /", []string{"1:1:1", "1:3:/"}},
+		{"word at the end without a newline", "1 print", []string{"1:1:1", "1:3:print"}},
+		{"leading whitespace", "\n  1\n", []string{"2:3:1"}},
+		{"comment between words", "1 // one\n  2\n", []string{"1:1:1", "2:3:2"}},
+		{"comment right after a word", "1 print// one\n2\n", []string{"1:1:1", "1:3:print", "2:1:2"}},
+		{"consecutive comments", "// a\n// b\n3\n", []string{"3:1:3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, token := range lexFile(test.content, "test.dodo") {
+				got = append(got, fmt.Sprintf("%v:%v:%v", token.Loc.Line, token.Loc.Col, token.Content))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got tokens %q, want %q", got, test.want)
+			}
+		})
+	}
+}
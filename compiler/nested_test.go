@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// nestedFlags are the sets of codegen flags the deeply nested programs in
+// testdata/nested are built with, `dodolang test` only builds them with the
+// default ones
+var nestedFlags = []struct {
+	name string
+	opts Options
+}{
+	{"default", Options{}},
+	{"O", Options{Optimize: true}},
+	{"no-peephole", Options{NoPeephole: true}},
+	{"O-checked-debug-stack", Options{Optimize: true, Checked: true, DebugStack: true}},
+}
+
+func TestNested(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("the built programs only run on linux/amd64")
+	}
+	sources, err := filepath.Glob(filepath.Join("..", "testdata", "nested", "*.dodo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no programs in testdata/nested")
+	}
+	dir := t.TempDir()
+	for _, path := range sources {
+		name := strings.TrimSuffix(filepath.Base(path), ".dodo")
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(path, ".dodo") + ".expected")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, flags := range nestedFlags {
+			t.Run(name+"/"+flags.name, func(t *testing.T) {
+				opts := flags.opts
+				opts.FilePath = filepath.Base(path)
+				opts.Emit, opts.Arch, opts.Syntax = "asm", "x86_64", "nasm"
+				result, diags := Compile(string(src), opts)
+				if HasErrors(diags) {
+					t.Fatalf("unexpected diagnostics %v", diags)
+				}
+				exe, err := Assemble(result.Code)
+				if err != nil {
+					t.Fatal(err)
+				}
+				exePath := filepath.Join(dir, name+"_"+flags.name)
+				if err := os.WriteFile(exePath, exe, 0755); err != nil {
+					t.Fatal(err)
+				}
+				got, err := exec.Command(exePath).Output()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("got output\n%v\nwant\n%v", string(got), string(want))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package compiler
+
+// optimizeProgram folds literal arithmetic and comparisons and removes the
+// branches and loops whose condition is a literal
+func optimizeProgram(program *Program) {
+	optimizeRoutine(&program.Main)
+	for i := range program.Quotes {
+		optimizeRoutine(&program.Quotes[i])
+	}
+}
+
+func optimizeRoutine(routine *Routine) {
+	for _, block := range routine.Blocks {
+		block.Instrs = foldConstants(block.Instrs)
+		foldBranch(block)
+	}
+	removeUnreachableBlocks(routine)
+}
+
+func isConstant(instr Instr) bool {
+	return instr.Op == OpPushInt || instr.Op == OpPushBool
+}
+
+func boolOperand(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// foldConstants evaluates instructions whose operands are pushed by the
+// instructions right before them, the result replaces all of them
+func foldConstants(instrs []Instr) []Instr {
+	var folded []Instr
+	for _, instr := range instrs {
+		n := len(folded)
+		if n >= 1 && isConstant(folded[n-1]) {
+			a := folded[n-1]
+			switch instr.Op {
+			case OpDup:
+				a.Loc = instr.Loc
+				folded = append(folded, a)
+				continue
+			case OpDrop:
+				folded = folded[:n-1]
+				continue
+			}
+		}
+		if n < 2 || !isConstant(folded[n-2]) || !isConstant(folded[n-1]) {
+			folded = append(folded, instr)
+			continue
+		}
+		a, b := folded[n-2].Operand, folded[n-1].Operand
+		result := Instr{Op: OpPushInt, Loc: instr.Loc, Site: instr.Site}
+		switch instr.Op {
+		case OpPlus:
+			result.Operand = a + b
+		case OpSub:
+			result.Operand = a - b
+		case OpMult:
+			result.Operand = a * b
+		case OpGt:
+			result = Instr{Op: OpPushBool, Operand: boolOperand(int64(a) > int64(b)), Loc: instr.Loc, Site: instr.Site}
+		case OpGe:
+			result = Instr{Op: OpPushBool, Operand: boolOperand(int64(a) >= int64(b)), Loc: instr.Loc, Site: instr.Site}
+		case OpLt:
+			result = Instr{Op: OpPushBool, Operand: boolOperand(int64(a) < int64(b)), Loc: instr.Loc, Site: instr.Site}
+		case OpLe:
+			result = Instr{Op: OpPushBool, Operand: boolOperand(int64(a) <= int64(b)), Loc: instr.Loc, Site: instr.Site}
+		case OpEq:
+			result = Instr{Op: OpPushBool, Operand: boolOperand(a == b), Loc: instr.Loc, Site: instr.Site}
+		case OpSwap:
+			folded[n-2], folded[n-1] = folded[n-1], folded[n-2]
+			continue
+		case OpDivMod:
+			// a division by zero is left for the runtime to report
+			if b == 0 {
+				folded = append(folded, instr)
+				continue
+			}
+			folded = folded[:n-2]
+			folded = append(folded,
+				Instr{Op: OpPushInt, Operand: a / b, Loc: instr.Loc, Site: instr.Site},
+				Instr{Op: OpPushInt, Operand: a % b, Loc: instr.Loc, Site: instr.Site},
+			)
+			continue
+		default:
+			folded = append(folded, instr)
+			continue
+		}
+		folded = append(folded[:n-2], result)
+	}
+	return folded
+}
+
+// foldBranch turns a branch on a literal condition into a jump
+func foldBranch(block *Block) {
+	n := len(block.Instrs)
+	if block.Term.Kind != TermBranch || n == 0 || !isConstant(block.Instrs[n-1]) {
+		return
+	}
+	target := block.Term.Then
+	if block.Instrs[n-1].Operand == 0 {
+		target = block.Term.Else
+	}
+	block.Instrs = block.Instrs[:n-1]
+	block.Term = Term{Kind: TermJump, Then: target, Loc: block.Term.Loc, Site: block.Term.Site}
+}
+
+// removeUnreachableBlocks drops the blocks that cannot be reached from the
+// entry and renumbers the rest, so that block IDs stay their index
+func removeUnreachableBlocks(routine *Routine) {
+	reachable := make([]bool, len(routine.Blocks))
+	work := []int{0}
+	for len(work) > 0 {
+		id := work[len(work)-1]
+		work = work[:len(work)-1]
+		if reachable[id] {
+			continue
+		}
+		reachable[id] = true
+		term := routine.Blocks[id].Term
+		switch term.Kind {
+		case TermJump:
+			work = append(work, term.Then)
+		case TermBranch:
+			work = append(work, term.Then, term.Else)
+		}
+	}
+	newID := make([]int, len(routine.Blocks))
+	var blocks []*Block
+	for id, block := range routine.Blocks {
+		if reachable[id] {
+			newID[id] = len(blocks)
+			blocks = append(blocks, block)
+		}
+	}
+	for _, block := range blocks {
+		block.ID = newID[block.ID]
+		block.Term.Then = newID[block.Term.Then]
+		block.Term.Else = newID[block.Term.Else]
+	}
+	routine.Blocks = blocks
+}
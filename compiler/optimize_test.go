@@ -0,0 +1,146 @@
+package compiler
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func pushInt(n int64) Instr {
+	return Instr{Op: OpPushInt, Operand: uint64(n)}
+}
+
+func pushBool(b bool) Instr {
+	return Instr{Op: OpPushBool, Operand: boolOperand(b)}
+}
+
+func op(o Op) Instr {
+	return Instr{Op: o}
+}
+
+func instrStrings(instrs []Instr) []string {
+	var strs []string
+	for _, instr := range instrs {
+		switch instr.Op {
+		case OpPushInt:
+			strs = append(strs, strconv.FormatInt(int64(instr.Operand), 10))
+		case OpPushBool:
+			strs = append(strs, strconv.FormatBool(instr.Operand != 0))
+		default:
+			strs = append(strs, opStr[instr.Op])
+		}
+	}
+	return strs
+}
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		name   string
+		instrs []Instr
+		want   []string
+	}{
+		{"plus", []Instr{pushInt(2), pushInt(3), op(OpPlus)}, []string{"5"}},
+		{"sub below zero", []Instr{pushInt(2), pushInt(3), op(OpSub)}, []string{"-1"}},
+		{"mult", []Instr{pushInt(-4), pushInt(3), op(OpMult)}, []string{"-12"}},
+		{"overflow wraps", []Instr{pushInt(math.MaxInt64), pushInt(1), op(OpPlus)}, []string{"-9223372036854775808"}},
+		{"chain", []Instr{pushInt(1), pushInt(2), op(OpPlus), pushInt(3), op(OpMult)}, []string{"9"}},
+		{"signed comparison", []Instr{pushInt(-1), pushInt(1), op(OpLt)}, []string{"true"}},
+		{"gt", []Instr{pushInt(1), pushInt(1), op(OpGt)}, []string{"false"}},
+		{"ge", []Instr{pushInt(1), pushInt(1), op(OpGe)}, []string{"true"}},
+		{"le", []Instr{pushInt(2), pushInt(1), op(OpLe)}, []string{"false"}},
+		{"eq", []Instr{pushInt(7), pushInt(7), op(OpEq)}, []string{"true"}},
+		{"swap", []Instr{pushInt(1), pushInt(2), op(OpSwap)}, []string{"2", "1"}},
+		{"dup", []Instr{pushInt(1), op(OpDup), op(OpPlus)}, []string{"2"}},
+		{"drop", []Instr{pushInt(1), pushInt(2), op(OpDrop)}, []string{"1"}},
+		{"divmod", []Instr{pushInt(7), pushInt(2), op(OpDivMod)}, []string{"3", "1"}},
+		// the runtime reports the division by zero, or traps on it with --checked
+		{"divmod by zero", []Instr{pushInt(7), pushInt(0), op(OpDivMod)}, []string{"7", "0", "divmod"}},
+		{"operand from memory", []Instr{pushInt(1), op(OpPushVar), op(OpPlus)}, []string{"1", "push-var", "+"}},
+		{"bool operand kept", []Instr{pushBool(true), op(OpPrint)}, []string{"true", "print"}},
+		{"print in between", []Instr{pushInt(1), op(OpPrint), pushInt(2), op(OpPlus)}, []string{"1", "print", "2", "+"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := instrStrings(foldConstants(test.instrs)); !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFoldBranch(t *testing.T) {
+	tests := []struct {
+		name   string
+		instrs []Instr
+		want   Term
+		left   int
+	}{
+		{"true", []Instr{pushInt(1), pushBool(true)}, Term{Kind: TermJump, Then: 1}, 1},
+		{"false", []Instr{pushBool(false)}, Term{Kind: TermJump, Then: 2}, 0},
+		{"computed", []Instr{pushInt(1), op(OpPushVar), op(OpEq)}, Term{Kind: TermBranch, Then: 1, Else: 2}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := &Block{Instrs: test.instrs, Term: Term{Kind: TermBranch, Then: 1, Else: 2}}
+			foldBranch(block)
+			if block.Term != test.want || len(block.Instrs) != test.left {
+				t.Errorf("got %+v with %v instructions, want %+v with %v", block.Term, len(block.Instrs), test.want, test.left)
+			}
+		})
+	}
+}
+
+func TestRemoveUnreachableBlocks(t *testing.T) {
+	routine := Routine{Name: "main", Blocks: []*Block{
+		{ID: 0, Instrs: []Instr{pushBool(true)}, Term: Term{Kind: TermBranch, Then: 2, Else: 1}},
+		{ID: 1, Instrs: []Instr{pushInt(1), op(OpPrint)}, Term: Term{Kind: TermJump, Then: 3}},
+		{ID: 2, Instrs: []Instr{pushInt(2), op(OpPrint)}, Term: Term{Kind: TermJump, Then: 3}},
+		{ID: 3, Term: Term{Kind: TermReturn}},
+		{ID: 4, Term: Term{Kind: TermJump, Then: 3}},
+	}}
+	optimizeRoutine(&routine)
+	want := "main:\n" +
+		"  b0:\n" +
+		"    jump b1\n" +
+		"  b1:\n" +
+		"    push-int 2\n" +
+		"    print 0\n" +
+		"    jump b2\n" +
+		"  b2:\n" +
+		"    return\n"
+	if got := routine.String(); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+	for i, block := range routine.Blocks {
+		if block.ID != i {
+			t.Errorf("block %v has id %v", i, block.ID)
+		}
+	}
+}
+
+func TestOptimizeKeepsRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts Options
+		want string
+	}{
+		{"checked divmod by zero", "7 0 divmod print print\n", Options{Optimize: true, Checked: true}, "division by zero"},
+		{"divmod by zero", "7 0 divmod print print\n", Options{Optimize: true}, "; -- DivMod --"},
+		{"folded assert", "1 1 = assert\n", Options{Optimize: true}, "; -- Assert --"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.opts.FilePath = "test.dodo"
+			result, diags := Compile(test.src, test.opts)
+			if HasErrors(diags) {
+				t.Fatalf("unexpected diagnostics %v", diags)
+			}
+			if !strings.Contains(result.Code, test.want) {
+				t.Errorf("the code has no %q", test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,650 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var tokenKindStr = map[string]TokenType{
+	"int":  TokenInt,
+	"bool": TokenBool,
+	"ptr":  TokenPtr,
+}
+
+type quoteFrame struct {
+	quote  Quote
+	parent *[]Token
+}
+
+// openBlock is an `if`, `for` or `let` waiting for its `end`, open and
+// last are the indices of its first and latest keyword in the body it is in
+type openBlock struct {
+	body *[]Token
+	open int
+	last int
+}
+
+// innermostBlock returns the innermost open block when it was opened in body,
+// blocks cannot be continued or closed from inside of a quotation or macro
+func innermostBlock(blockStack []openBlock, body *[]Token) (*openBlock, bool) {
+	if len(blockStack) == 0 || blockStack[len(blockStack)-1].body != body {
+		return nil, false
+	}
+	return &blockStack[len(blockStack)-1], true
+}
+
+// noteOuterBlock points at the innermost open block when it is outside of the
+// quotation or macro that a keyword is in, as it cannot be continued from there
+func noteOuterBlock(d *Diagnostic, blockStack []openBlock, body *[]Token) {
+	if len(blockStack) == 0 || blockStack[len(blockStack)-1].body == body {
+		return
+	}
+	block := blockStack[len(blockStack)-1]
+	open := (*block.body)[block.open]
+	d.notef(open.Loc, "the `%v` block opened here is outside of this quotation or macro", tokenName(open.Type))
+}
+
+// letScope holds the names bound by a `let`, a barrier scope hides every
+// binding below it, as quotes and macros cannot reach into the enclosing frames
+type letScope struct {
+	names   []string
+	locs    []Location
+	used    []bool
+	barrier bool
+}
+
+// lookupLocal finds the slot of a `let` binding, counted in 8 byte slots
+// from the top of the return stack, and marks the binding as used
+func lookupLocal(scopes []letScope, name string) (uint64, bool) {
+	slot := uint64(0)
+	for i := len(scopes) - 1; i >= 0; i-- {
+		scope := scopes[i]
+		if scope.barrier {
+			return 0, false
+		}
+		for j, n := range scope.names {
+			if n == name {
+				scope.used[j] = true
+				return slot + uint64(j), true
+			}
+		}
+		slot += uint64(len(scope.names))
+	}
+	return 0, false
+}
+
+// warnUnusedBindings warns about the names of a `let` that its body never uses,
+// names starting with `_` are meant to be dropped
+func (c *compiler) warnUnusedBindings(scope letScope) {
+	for j, name := range scope.names {
+		if !scope.used[j] && !strings.HasPrefix(name, "_") {
+			c.diags.warningf(scope.locs[j], WarnUnusedBinding, "`%v` is bound but never used", name)
+		}
+	}
+}
+
+// parseTokens turns the lexed words into tokens and records the problems in
+// the diagnostics, it recovers from every error by skipping the offending
+// word or closing what is left open, so the returned tokens are always well nested
+func (c *compiler) parseTokens(strTokens []StringToken, state *CompileState) []Token {
+	var (
+		mainTokenBuffer    []Token
+		macroTokenBuffer   []Token
+		currentTokenBuffer *[]Token = &mainTokenBuffer
+		macroMode          bool
+		macroParentBuffer  *[]Token
+		macroQuoteDepth    int
+		currentMacroName   string
+		currentMacro       Macro
+		quoteStack         []*quoteFrame
+		letScopes          []letScope
+		blockStack         []openBlock
+		blockCount         int
+		pendingExport      string
+		t                  Token
+	)
+	if len(strTokens) == 0 {
+		return mainTokenBuffer
+	}
+	t.Loc.FilePath = strTokens[0].Loc.FilePath
+	assert(TokenCount == 41, "Exhaustive switch case for ParseToken")
+
+	// closeBlock appends the `end` of the innermost block and links it, the `end`
+	// that closes a block that is never closed is placed at the block itself
+	closeBlock := func(loc Location) {
+		block := blockStack[len(blockStack)-1]
+		blockStack = blockStack[:len(blockStack)-1]
+		open := (*block.body)[block.open]
+		index := len(*block.body)
+		(*block.body)[block.last].Jump = index
+		end := Token{Type: TokenEnd, Loc: loc, Block: open.Block, Jump: block.open}
+		if open.Type == TokenLet {
+			// the `end` of a `let` knows the size of the frame it releases
+			end.Operand = open.Operand
+			if loc != open.Loc {
+				c.warnUnusedBindings(letScopes[len(letScopes)-1])
+			}
+			letScopes = letScopes[:len(letScopes)-1]
+		}
+		*block.body = append(*block.body, end)
+	}
+	// closeUnclosedBlocks reports and closes the blocks left open in the current body
+	closeUnclosedBlocks := func() {
+		for {
+			block, found := innermostBlock(blockStack, currentTokenBuffer)
+			if !found {
+				return
+			}
+			open := (*block.body)[block.open]
+			c.diags.errorf(open.Loc, ErrUnclosed, "`%v` block is never closed with `end`", tokenName(open.Type))
+			closeBlock(open.Loc)
+		}
+	}
+	closeQuote := func(loc Location) {
+		closeUnclosedBlocks()
+		frame := quoteStack[len(quoteStack)-1]
+		quoteStack = quoteStack[:len(quoteStack)-1]
+		letScopes = letScopes[:len(letScopes)-1]
+		// quotes get their id when they are closed, so a nested quote
+		// always has a smaller id than the quote it is nested in
+		c.quotes = append(c.quotes, frame.quote)
+		currentTokenBuffer = frame.parent
+		if frame.quote.Export != "" {
+			c.exports[frame.quote.Export] = len(c.quotes) - 1
+			return
+		}
+		*currentTokenBuffer = append(*currentTokenBuffer, Token{Type: TokenQuote, Loc: loc, Operand: uint64(len(c.quotes) - 1)})
+	}
+	closeMacro := func(loc Location) {
+		for len(quoteStack) > macroQuoteDepth {
+			quote := quoteStack[len(quoteStack)-1].quote
+			c.diags.errorf(quote.Loc, ErrUnclosed, "unclosed quotation inside of macro definition, expected `]`").
+				notef(loc, "macro `%v` ends here", currentMacroName)
+			closeQuote(loc)
+		}
+		closeUnclosedBlocks()
+		macroTokenBuffer = append(macroTokenBuffer, Token{Type: TokenMacroEnd, Loc: loc})
+		currentMacro.Body = macroTokenBuffer
+		c.macros[currentMacroName] = currentMacro
+		currentTokenBuffer = macroParentBuffer
+		letScopes = letScopes[:len(letScopes)-1]
+		macroTokenBuffer = []Token{}
+		macroMode = false
+	}
+
+	for i := 0; i < len(strTokens); i++ {
+		strTok := strTokens[i]
+		if len(strTok.Content) == 0 {
+			continue
+		}
+		mapTok, exists := tokenStr[strTok.Content]
+		t.Block, t.Jump = 0, 0
+		_, blockOpen := innermostBlock(blockStack, currentTokenBuffer)
+		if macroMode && mapTok == TokenEnd && !blockOpen {
+			closeMacro(strTok.Loc)
+			continue
+		}
+		if exists && mapTok == TokenMacro {
+			if i+1 >= len(strTokens) {
+				c.diags.errorf(strTok.Loc, ErrMalformed, "expected the name of the macro")
+				continue
+			}
+			if macroMode || len(quoteStack) > 0 {
+				where := "a macro"
+				if !macroMode {
+					where = "a quotation"
+				}
+				c.diags.errorf(strTok.Loc, ErrMisplaced, "macro definition inside of %v is not supported", where)
+				// the body of the definition is parsed as a part of the enclosing one
+				i++
+				if i+1 < len(strTokens) && strTokens[i+1].Content == "(" {
+					_, i = c.parseStackEffect(strTokens, i+1)
+				}
+				continue
+			}
+			macroParentBuffer = currentTokenBuffer
+			letScopes = append(letScopes, letScope{barrier: true})
+			macroQuoteDepth = len(quoteStack)
+			currentTokenBuffer = &macroTokenBuffer
+			macroMode = true
+			currentMacroName = strTokens[i+1].Content
+			currentMacro = Macro{Loc: strTokens[i+1].Loc}
+			i++
+			if i+1 < len(strTokens) && strTokens[i+1].Content == "(" {
+				currentMacro.Effect, i = c.parseStackEffect(strTokens, i+1)
+				currentMacro.Declared = true
+			}
+			continue
+		}
+		if exists && (mapTok == TokenExtern || mapTok == TokenExport) {
+			if macroMode || len(quoteStack) > 0 {
+				c.diags.errorf(strTok.Loc, ErrMisplaced, "`%v` is only allowed at the top level", strTok.Content)
+			}
+			usage := externUsage
+			next := "("
+			if mapTok == TokenExport {
+				usage = exportUsage
+				next = "["
+			}
+			if i+2 >= len(strTokens) || strTokens[i+2].Content != next {
+				c.diags.errorf(strTok.Loc, ErrMalformed, "expected a name followed by `%v`", next).help(usage)
+				continue
+			}
+			i++
+			c.parseSymbolName(strTokens[i], usage)
+			if mapTok == TokenExport {
+				pendingExport = strTokens[i].Content
+				continue
+			}
+			extern := Extern{Name: strTokens[i].Content, Loc: strTokens[i].Loc}
+			extern.Effect, i = c.parseStackEffect(strTokens, i+1)
+			c.checkCSignature(extern.Effect)
+			c.externs = append(c.externs, extern)
+			continue
+		}
+		if exists && mapTok == TokenQuote {
+			frame := &quoteFrame{parent: currentTokenBuffer}
+			frame.quote.Loc = strTok.Loc
+			frame.quote.Export = pendingExport
+			pendingExport = ""
+			if i+1 < len(strTokens) && strTokens[i+1].Content == "(" {
+				frame.quote.Effect, i = c.parseStackEffect(strTokens, i+1)
+				frame.quote.Declared = true
+			}
+			if frame.quote.Export != "" {
+				if frame.quote.Declared {
+					c.checkCSignature(frame.quote.Effect)
+				} else {
+					c.diags.errorf(
+						strTok.Loc,
+						ErrUndeclaredEffect,
+						"exported quotation `%v` needs a declared stack effect",
+						frame.quote.Export,
+					).help(exportUsage)
+				}
+			}
+			quoteStack = append(quoteStack, frame)
+			currentTokenBuffer = &frame.quote.Body
+			letScopes = append(letScopes, letScope{barrier: true})
+			continue
+		}
+		if exists && mapTok == TokenQuoteEnd {
+			if len(quoteStack) == 0 || (macroMode && len(quoteStack) == macroQuoteDepth) {
+				c.diags.errorf(strTok.Loc, ErrUnmatched, "`]` without a matching `[`")
+				continue
+			}
+			closeQuote(strTok.Loc)
+			continue
+		}
+		if exists && mapTok == TokenLet {
+			letTok := strTok
+			scope := letScope{}
+			for i++; i < len(strTokens) && strTokens[i].Content != "in"; i++ {
+				strTok = strTokens[i]
+				_, isKeyword := tokenStr[strTok.Content]
+				_, numErr := strconv.ParseUint(strTok.Content, 10, 64)
+				if isKeyword || numErr == nil {
+					c.diags.errorf(strTok.Loc, ErrInvalidName, "`%v` is not allowed as a binding name", strTok.Content).help(letUsage)
+					continue
+				}
+				if j := slices.Index(scope.names, strTok.Content); j >= 0 {
+					c.diags.errorf(strTok.Loc, ErrDuplicateName, "`%v` is bound more than once", strTok.Content).
+						notef(scope.locs[j], "first bound here")
+					continue
+				}
+				scope.names = append(scope.names, strTok.Content)
+				scope.locs = append(scope.locs, strTok.Loc)
+				scope.used = append(scope.used, false)
+			}
+			if i >= len(strTokens) || len(scope.names) == 0 {
+				c.diags.errorf(letTok.Loc, ErrMalformed, "expected at least one name followed by `in`").help(letUsage)
+				if i >= len(strTokens) {
+					continue
+				}
+			}
+			letScopes = append(letScopes, scope)
+			t.Loc = letTok.Loc
+			t.Type = TokenLet
+			t.Operand = uint64(len(scope.names))
+			blockCount++
+			t.Block = blockCount
+			index := len(*currentTokenBuffer)
+			blockStack = append(blockStack, openBlock{body: currentTokenBuffer, open: index, last: index})
+			*currentTokenBuffer = append(*currentTokenBuffer, t)
+			continue
+		}
+		if exists && mapTok == TokenVar {
+			var (
+				varKind TokenType = TokenInt
+				varName string
+			)
+			if i+3 >= len(strTokens) {
+				c.diags.errorf(strTok.Loc, ErrMalformed, "expected variable definition").help(varUsage)
+				i = len(strTokens)
+				continue
+			}
+			valid := true
+			{
+				i++
+				strTok = strTokens[i]
+				varName = strTok.Content
+				if tmpT, e := tokenStr[strTok.Content]; e {
+					c.diags.errorf(
+						strTok.Loc,
+						ErrInvalidName,
+						"expected a name found keyword `%v`, keywords are not allowed as variable names",
+						tokenName(tmpT),
+					).help(varUsage)
+					valid = false
+				}
+			}
+			{
+				i++
+				strTok = strTokens[i]
+				if kind, e := tokenKindStr[strTok.Content]; e {
+					varKind = kind
+				} else {
+					c.diags.errorf(strTok.Loc, ErrUnknownType, "expected type found %v", strTok.Content).help(varUsage)
+				}
+			}
+			{
+				i++
+				strTok = strTokens[i]
+				if _, e := tokenStr[strTok.Content]; !e {
+					c.diags.errorf(strTok.Loc, ErrMalformed, "expected `end` found `%v`", strTok.Content).help(varUsage)
+				}
+			}
+			if !valid {
+				continue
+			}
+			// TODO(@siiick): swap Token.Kind and Token.Type as `kind` implies things like `end`, `for` etc, while `type` is `int`, `bool` etc
+			t.Loc = strTok.Loc
+			t.Kind = varKind   // var type
+			t.Type = TokenWord // token type
+			t.Operand = state.varBufSize
+			c.vars[varName] = t
+			state.varBufSize += 8
+			continue
+		}
+
+		if !exists {
+			t.Loc = strTok.Loc
+			if num, err := strconv.ParseUint(strTok.Content, 10, 64); err == nil {
+				t.Type = TokenInt
+				t.Operand = num
+				*currentTokenBuffer = append(*currentTokenBuffer, t)
+				continue
+			}
+			if slot, found := lookupLocal(letScopes, strTok.Content); found {
+				t.Type = TokenLocal
+				t.Operand = slot
+				*currentTokenBuffer = append(*currentTokenBuffer, t)
+				continue
+			}
+			if id, found := c.exports[strTok.Content]; found {
+				// an exported quotation is called like any other one
+				t.Type = TokenQuote
+				t.Operand = uint64(id)
+				*currentTokenBuffer = append(*currentTokenBuffer, t)
+				t.Type = TokenCall
+				t.Operand = 0
+				*currentTokenBuffer = append(*currentTokenBuffer, t)
+				continue
+			}
+			_, macroFound := c.macros[strTok.Content]
+			_, varFound := c.vars[strTok.Content]
+			_, externFound := c.lookupExtern(strTok.Content)
+			if !macroFound && !varFound && !externFound {
+				// the word stays in the body, so that the type checker knows
+				// that it cannot tell what the stack looks like after it
+				c.diags.errorf(strTok.Loc, ErrUndefinedWord, "undefined word `%v`", strTok.Content)
+				c.undefined[i] = true
+			}
+			t.Type = TokenWord
+			t.Operand = uint64(i)
+			*currentTokenBuffer = append(*currentTokenBuffer, t)
+		} else {
+			t.Loc = strTok.Loc
+			t.Type = mapTok
+			t.Operand = 0
+			index := len(*currentTokenBuffer)
+			switch mapTok {
+			case TokenFor, TokenIf:
+				blockCount++
+				t.Block = blockCount
+				blockStack = append(blockStack, openBlock{body: currentTokenBuffer, open: index, last: index})
+			case TokenElse, TokenDo:
+				opener := TokenType(TokenIf)
+				if mapTok == TokenDo {
+					opener = TokenFor
+				}
+				block, found := innermostBlock(blockStack, currentTokenBuffer)
+				if !found || (*block.body)[block.open].Type != opener {
+					d := c.diags.errorf(strTok.Loc, ErrUnmatched, "`%v` without a matching `%v`", strTok.Content, tokenName(opener))
+					noteOuterBlock(d, blockStack, currentTokenBuffer)
+					continue
+				}
+				if block.last != block.open {
+					open := (*block.body)[block.open]
+					c.diags.errorf(strTok.Loc, ErrUnmatched, "`%v` cannot have a second `%v`", tokenName(opener), strTok.Content).
+						notef((*block.body)[block.last].Loc, "first `%v` here", strTok.Content).
+						notef(open.Loc, "block opened here")
+					continue
+				}
+				(*block.body)[block.last].Jump = index
+				block.last = index
+				t.Block = (*block.body)[block.open].Block
+			case TokenEnd:
+				block, found := innermostBlock(blockStack, currentTokenBuffer)
+				if !found {
+					d := c.diags.errorf(strTok.Loc, ErrUnmatched, "`end` without an open block")
+					noteOuterBlock(d, blockStack, currentTokenBuffer)
+					continue
+				}
+				open := (*block.body)[block.open]
+				if open.Type == TokenFor && block.last == block.open {
+					c.diags.errorf(strTok.Loc, ErrUnmatched, "`for` loop is closed without a `do`").
+						notef(open.Loc, "loop opened here")
+				}
+				closeBlock(strTok.Loc)
+				continue
+			}
+			*currentTokenBuffer = append(*currentTokenBuffer, t)
+		}
+	}
+	end := strTokens[len(strTokens)-1].Loc
+	if macroMode {
+		c.diags.errorf(currentMacro.Loc, ErrUnclosed, "macro `%v` is never closed with `end`", currentMacroName)
+		closeMacro(end)
+	}
+	for len(quoteStack) > 0 {
+		quote := quoteStack[len(quoteStack)-1].quote
+		c.diags.errorf(quote.Loc, ErrUnclosed, "unclosed quotation, expected `]`")
+		closeQuote(end)
+	}
+	closeUnclosedBlocks()
+
+	return mainTokenBuffer
+}
+
+var varUsage = []any{
+	"variable definition looks like this: \n",
+	"  `var <var-name> <var-type> end`\n",
+	"eg: \n",
+	"  `var x int end`",
+}
+
+var letUsage = []any{
+	"let binding looks like this: \n",
+	"  `let <names> in <body> end`\n",
+	"eg: \n",
+	"  `let a b in a b + end`",
+}
+
+var stackEffectUsage = []any{
+	"stack effect looks like this: \n",
+	"  `( <input-types> -- <output-types> )`\n",
+	"eg: \n",
+	"  `( int int -- bool )`",
+}
+
+var externUsage = []any{
+	"extern declaration looks like this: \n",
+	"  `extern <name> ( <input-types> -- <output-types> )`\n",
+	"eg: \n",
+	"  `extern abs ( int -- int )`",
+}
+
+var exportUsage = []any{
+	"export looks like this: \n",
+	"  `export <name> [ ( <input-types> -- <output-types> ) <body> ]`\n",
+	"eg: \n",
+	"  `export add [ ( int int -- int ) + ]`",
+}
+
+// parseSymbolName checks that the name of an `extern` or `export` can be a C symbol
+func (c *compiler) parseSymbolName(strTok StringToken, usage []any) {
+	name := strTok.Content
+	_, isKeyword := tokenStr[name]
+	macro, isMacro := c.macros[name]
+	v, isVar := c.vars[name]
+	externID, isExtern := c.lookupExtern(name)
+	exportID, isExport := c.exports[name]
+	_, numErr := strconv.ParseUint(name, 10, 64)
+	switch {
+	case isKeyword || numErr == nil || !cSymbolRegexp.MatchString(name):
+		c.diags.errorf(strTok.Loc, ErrInvalidName, "`%v` is not allowed as a symbol name", name).help(usage)
+	case reservedSymbols[name] || strings.HasPrefix(name, "main_") || strings.HasPrefix(name, "quote_"):
+		c.diags.errorf(strTok.Loc, ErrReservedName, "`%v` is reserved for the generated code", name)
+	case isMacro || isVar || isExtern || isExport:
+		var defined Location
+		switch {
+		case isMacro:
+			defined = macro.Loc
+		case isVar:
+			defined = v.Loc
+		case isExtern:
+			defined = c.externs[externID].Loc
+		case isExport:
+			defined = c.quotes[exportID].Loc
+		}
+		c.diags.errorf(strTok.Loc, ErrDuplicateName, "`%v` is already defined", name).
+			notef(defined, "previous definition here")
+	}
+}
+
+var cSymbolRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkCSignature checks that effect fits into the argument and return registers of a C call
+func (c *compiler) checkCSignature(effect StackEffect) {
+	loc := effect.Loc
+	if len(effect.Ins) > len(cArgRegisters) {
+		c.diags.errorf(loc, ErrCSignature, "a C function takes at most %v arguments, found %v", len(cArgRegisters), len(effect.Ins))
+	}
+	if len(effect.Outs) > 1 {
+		c.diags.errorf(loc, ErrCSignature, "a C function returns at most 1 value, found %v", len(effect.Outs))
+	}
+}
+
+// parseStackEffect parses a stack effect declaration like `( int ptr -- bool )`,
+// i is the index of the opening `(` and the index of the closing `)` is returned,
+// an effect without `)` takes the rest of the file
+func (c *compiler) parseStackEffect(strTokens []StringToken, i int) (StackEffect, int) {
+	effect := StackEffect{Loc: strTokens[i].Loc}
+	outs := false
+	for i++; i < len(strTokens); i++ {
+		strTok := strTokens[i]
+		switch strTok.Content {
+		case "--":
+			if outs {
+				c.diags.errorf(strTok.Loc, ErrMalformed, "duplicate `--` in stack effect")
+			}
+			outs = true
+		case ")":
+			if !outs {
+				c.diags.errorf(strTok.Loc, ErrMalformed, "expected `--` in stack effect").help(stackEffectUsage)
+			}
+			return effect, i
+		default:
+			kind, e := tokenKindStr[strTok.Content]
+			if !e {
+				c.diags.errorf(strTok.Loc, ErrUnknownType, "expected type found %v", strTok.Content).help(stackEffectUsage)
+				continue
+			}
+			info := TypeInfo{Type: kind, Kind: kind}
+			if kind == TokenPtr {
+				// all variables are 64 bit ints for now
+				info.Kind = TokenInt
+			}
+			if outs {
+				effect.Outs = append(effect.Outs, info)
+			} else {
+				effect.Ins = append(effect.Ins, info)
+			}
+		}
+	}
+	c.diags.errorf(effect.Loc, ErrUnclosed, "unterminated stack effect, expected `)`")
+	return effect, i
+}
+
+var tokenStr = map[string]TokenType{
+	"+":        TokenPlus,
+	"-":        TokenSub,
+	"*":        TokenMult,
+	"divmod":   TokenDivMod,
+	"print":    TokenPrint,
+	"swap":     TokenSwap,
+	"dup":      TokenDup,
+	"drop":     TokenDrop,
+	">":        TokenGt,
+	">=":       TokenGe,
+	"<":        TokenLt,
+	"<=":       TokenLe,
+	"=":        TokenEq,
+	"for":      TokenFor,
+	"do":       TokenDo,
+	"if":       TokenIf,
+	"else":     TokenElse,
+	"end":      TokenEnd,
+	"macro":    TokenMacro,
+	"syscall1": TokenSyscall1,
+	"syscall3": TokenSyscall3,
+	"rot":      TokenRot,
+	"@":        TokenRead,
+	"!":        TokenWrite,
+	"var":      TokenVar,
+	"true":     TokenTrue,
+	"false":    TokenFalse,
+	"[":        TokenQuote,
+	"]":        TokenQuoteEnd,
+	"call":     TokenCall,
+	"let":      TokenLet,
+	"in":       TokenIn,
+	"assert":   TokenAssert,
+	"extern":   TokenExtern,
+	"export":   TokenExport,
+}
+
+// tokenName is how a keyword or intrinsic is spelled in the source
+func tokenName(tokenType TokenType) string {
+	for name, t := range tokenStr {
+		if t == tokenType {
+			return name
+		}
+	}
+	return intrinsicStr[tokenType]
+}
+
+func printTokens(ts []Token) {
+	for _, v := range ts {
+		typ, found := intrinsicStr[v.Type]
+		if found {
+			fmt.Printf("%v: %+v\n", typ, v)
+		} else {
+			fmt.Printf("%v: %+v\n", "[INVALID_TYPE]", v)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// asmLine is a line of the generated assembly, comments and labels
+// have no mnemonic
+type asmLine struct {
+	text     string
+	label    string
+	mnemonic string
+	operands []string
+	// removed by a rewrite, the line is dropped when the code is joined again
+	removed bool
+}
+
+func (l asmLine) isInstr() bool {
+	return l.mnemonic != ""
+}
+
+func parseAsmLine(text string) asmLine {
+	line := asmLine{text: text}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "%") {
+		return line
+	}
+	if strings.HasSuffix(trimmed, ":") {
+		line.label = strings.TrimSuffix(trimmed, ":")
+		return line
+	}
+	mnemonic, rest, _ := strings.Cut(trimmed, " ")
+	line.mnemonic = mnemonic
+	if rest = strings.TrimSpace(rest); rest != "" {
+		for _, op := range strings.Split(rest, ",") {
+			line.operands = append(line.operands, strings.TrimSpace(op))
+		}
+	}
+	return line
+}
+
+func newAsmLine(format string, args ...any) asmLine {
+	return parseAsmLine(fmt.Sprintf(format, args...))
+}
+
+var subRegisters = map[string]string{
+	"al": "rax", "eax": "rax",
+	"bl": "rbx", "ebx": "rbx",
+	"cl": "rcx", "ecx": "rcx",
+	"dl": "rdx", "edx": "rdx",
+	"sil": "rsi", "esi": "rsi",
+	"dil": "rdi", "edi": "rdi",
+	"r8b": "r8", "r9b": "r9", "r10b": "r10", "r11b": "r11",
+	"r12b": "r12", "r13b": "r13", "r14b": "r14", "r15b": "r15",
+}
+
+var registerRegexp = regexp.MustCompile(`^(r[a-d]x|r[sd]i|r[sb]p|r[0-9]+)$`)
+
+// register returns the 64 bit register an operand names
+func register(operand string) (string, bool) {
+	if reg, ok := subRegisters[operand]; ok {
+		return reg, true
+	}
+	return operand, registerRegexp.MatchString(operand)
+}
+
+var memoryRegisterRegexp = regexp.MustCompile(`\b(r[a-d]x|r[sd]i|r[sb]p|r[0-9]+)\b`)
+
+// addressRegisters returns the registers used to compute a memory operand
+func addressRegisters(operand string) []string {
+	if !strings.Contains(operand, "[") {
+		return nil
+	}
+	return memoryRegisterRegexp.FindAllString(operand, -1)
+}
+
+func isBlockLabel(label string) bool {
+	return blockLabelRegexp.MatchString(label)
+}
+
+var blockLabelRegexp = regexp.MustCompile(`_b[0-9]+$`)
+
+// registers clobbered by the `print` runtime routine and by `syscall`
+var (
+	printClobbers   = []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "r9", "r11"}
+	syscallReads    = []string{"rax", "rdi", "rsi", "rdx", "r10", "r8", "r9"}
+	syscallClobbers = []string{"rax", "rcx", "r11"}
+	// a quote may use any register but the return stack pointer
+	quoteClobbers = []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "r8", "r9", "r10", "r11", "r12", "r13", "r14"}
+)
+
+// regEffect describes how an instruction uses a register, unknown
+// instructions are treated as reading every register
+func regEffect(line asmLine, reg string) (reads bool, writes bool) {
+	uses := func(operand string) bool {
+		r, ok := register(operand)
+		return ok && r == reg
+	}
+	inAddress := false
+	for _, op := range line.operands {
+		for _, r := range addressRegisters(op) {
+			if r == reg {
+				inAddress = true
+			}
+		}
+	}
+	contains := func(regs []string) bool {
+		for _, r := range regs {
+			if r == reg {
+				return true
+			}
+		}
+		return false
+	}
+	ops := line.operands
+	switch line.mnemonic {
+	case "mov", "movzx", "lea":
+		return inAddress || uses(ops[1]), uses(ops[0])
+	case "pop":
+		return inAddress, uses(ops[0])
+	case "push":
+		return inAddress || uses(ops[0]), false
+	case "xor":
+		if ops[0] == ops[1] {
+			return false, uses(ops[0])
+		}
+		return inAddress || uses(ops[0]) || uses(ops[1]), uses(ops[0])
+	case "add", "sub", "imul", "and", "or":
+		return inAddress || uses(ops[0]) || uses(ops[1]), uses(ops[0])
+	case "cmp", "test":
+		return inAddress || uses(ops[0]) || uses(ops[1]), false
+	case "inc", "dec", "neg", "not":
+		return inAddress || uses(ops[0]), uses(ops[0])
+	case "mul", "div":
+		return inAddress || uses(ops[0]) || reg == "rax" || (line.mnemonic == "div" && reg == "rdx"),
+			reg == "rax" || reg == "rdx"
+	case "sete", "setne", "setg", "setge", "setl", "setle", "seta", "setae", "setb", "setbe":
+		// only the low byte is written, so the rest of the register is read
+		return inAddress || uses(ops[0]), uses(ops[0])
+	case "call":
+		if ops[0] == "print" {
+			return reg == "rdi", contains(printClobbers)
+		}
+		if _, isReg := register(ops[0]); !isReg {
+			// a C function declared with `extern` reads its arguments
+			return contains(cArgRegisters), contains(quoteClobbers)
+		}
+		return uses(ops[0]), contains(quoteClobbers)
+	case "syscall":
+		return contains(syscallReads), contains(syscallClobbers)
+	}
+	return true, false
+}
+
+// regDeadScanLimit bounds how many instructions regDeadAfter looks at, a
+// value that is not read or overwritten by then is treated as live so that
+// long blocks are not scanned again for every rewrite
+const regDeadScanLimit = 64
+
+// regDeadAfter reports whether the value in reg at lines[i] is never read,
+// nothing is live at the start of a block as values cross blocks on the stack
+func regDeadAfter(lines []asmLine, i int, reg string) bool {
+	scanned := 0
+	for j := i + 1; j < len(lines); j++ {
+		line := lines[j]
+		if line.label != "" {
+			return isBlockLabel(line.label)
+		}
+		if !line.isInstr() {
+			continue
+		}
+		switch {
+		case line.mnemonic == "ret":
+			return true
+		case line.mnemonic == "jmp":
+			return isBlockLabel(line.operands[0])
+		case strings.HasPrefix(line.mnemonic, "j"):
+			if !isBlockLabel(line.operands[0]) {
+				return false
+			}
+			continue
+		}
+		if scanned++; scanned > regDeadScanLimit {
+			return false
+		}
+		reads, writes := regEffect(line, reg)
+		if reads {
+			return false
+		}
+		if writes {
+			return true
+		}
+	}
+	return true
+}
+
+// nextInstr returns the index of the next instruction after i, or -1 when
+// a label comes first, as a label can be jumped to from elsewhere
+func nextInstr(lines []asmLine, i int) int {
+	for j := i + 1; j < len(lines); j++ {
+		if lines[j].label != "" {
+			return -1
+		}
+		if lines[j].isInstr() {
+			return j
+		}
+	}
+	return -1
+}
+
+func fitsImm32(operand string) bool {
+	n, err := strconv.ParseInt(operand, 10, 64)
+	return err == nil && n >= -(1<<31) && n < 1<<31
+}
+
+// peepholeWindow is the number of instructions a rule looks at after the
+// first one, a rewrite can complete a pattern that starts that far before it
+const peepholeWindow = 2
+
+// peephole rewrites redundant instruction sequences of the generated code
+// until there is nothing left to rewrite. Every rewrite removes a line, so
+// the code is scanned once and only the instructions right before a
+// rewrite are looked at again
+func peephole(code string) string {
+	var lines []asmLine
+	for _, text := range strings.Split(strings.TrimSuffix(code, "\n"), "\n") {
+		lines = append(lines, parseAsmLine(text))
+	}
+	for i := 0; i < len(lines); i++ {
+		if !lines[i].isInstr() || !peepholeAt(lines, i) {
+			continue
+		}
+		for back := 0; back < peepholeWindow && i > 0; {
+			i--
+			if lines[i].label != "" {
+				break
+			}
+			if lines[i].isInstr() {
+				back++
+			}
+		}
+		// the loop increments i again
+		i--
+	}
+	var sb strings.Builder
+	for _, line := range lines {
+		if line.removed {
+			continue
+		}
+		sb.WriteString(line.text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// peepholeAt applies the first rule that matches the instructions starting at i
+func peepholeAt(lines []asmLine, i int) bool {
+	a := lines[i]
+	j := nextInstr(lines, i)
+	if j < 0 {
+		return false
+	}
+	b := lines[j]
+	remove := func(idx ...int) bool {
+		for _, k := range idx {
+			lines[k] = asmLine{removed: true}
+		}
+		return true
+	}
+	if a.mnemonic == "push" && b.mnemonic == "pop" {
+		// push X / pop X
+		if a.operands[0] == b.operands[0] {
+			return remove(i, j)
+		}
+		// push X / pop Y => mov Y, X
+		if _, ok := register(b.operands[0]); ok {
+			lines[i] = newAsmLine("mov %v, %v", b.operands[0], a.operands[0])
+			return remove(j)
+		}
+	}
+	// pop R / push R, when R is not used afterwards
+	if a.mnemonic == "pop" && b.mnemonic == "push" && a.operands[0] == b.operands[0] {
+		if reg, ok := register(a.operands[0]); ok && regDeadAfter(lines, j, reg) {
+			return remove(i, j)
+		}
+	}
+	if a.mnemonic == "mov" {
+		reg, isReg := register(a.operands[0])
+		// mov R, imm / push R => push imm
+		if isReg && b.mnemonic == "push" && b.operands[0] == a.operands[0] &&
+			fitsImm32(a.operands[1]) && regDeadAfter(lines, j, reg) {
+			lines[i] = newAsmLine("push %v", a.operands[1])
+			return remove(j)
+		}
+		// mov R, 1 / add S, R => inc S
+		if isReg && a.operands[1] == "1" && (b.mnemonic == "add" || b.mnemonic == "sub") &&
+			b.operands[1] == a.operands[0] && b.operands[0] != a.operands[0] && regDeadAfter(lines, j, reg) {
+			mnemonic := "inc"
+			if b.mnemonic == "sub" {
+				mnemonic = "dec"
+			}
+			lines[j] = newAsmLine("%v %v", mnemonic, b.operands[0])
+			return remove(i)
+		}
+		// mov R, imm / cmp S, R => cmp S, imm
+		if isReg && fitsImm32(a.operands[1]) && (b.mnemonic == "add" || b.mnemonic == "sub" || b.mnemonic == "cmp") &&
+			b.operands[1] == a.operands[0] && b.operands[0] != a.operands[0] && regDeadAfter(lines, j, reg) {
+			lines[j] = newAsmLine("%v %v, %v", b.mnemonic, b.operands[0], a.operands[1])
+			return remove(i)
+		}
+		// mov R, 1 / pop S / add R, S => pop R / inc R
+		if k := nextInstr(lines, j); isReg && a.operands[1] == "1" && b.mnemonic == "pop" && k >= 0 {
+			c := lines[k]
+			s, sIsReg := register(b.operands[0])
+			if sIsReg && s != reg && c.mnemonic == "add" && len(c.operands) == 2 &&
+				c.operands[0] == a.operands[0] && c.operands[1] == b.operands[0] && regDeadAfter(lines, k, s) {
+				lines[i] = newAsmLine("pop %v", a.operands[0])
+				lines[j] = newAsmLine("inc %v", a.operands[0])
+				return remove(k)
+			}
+			// mov R, 1 / pop S / sub S, R => pop S / dec S
+			if sIsReg && s != reg && (c.mnemonic == "add" || c.mnemonic == "sub") && len(c.operands) == 2 &&
+				c.operands[0] == b.operands[0] && c.operands[1] == a.operands[0] && regDeadAfter(lines, k, reg) {
+				mnemonic := "inc"
+				if c.mnemonic == "sub" {
+					mnemonic = "dec"
+				}
+				lines[k] = newAsmLine("%v %v", mnemonic, b.operands[0])
+				return remove(i)
+			}
+		}
+	}
+	// pop R / inc R / push R => inc qword [rsp]
+	if k := nextInstr(lines, j); a.mnemonic == "pop" && (b.mnemonic == "inc" || b.mnemonic == "dec") && k >= 0 {
+		c := lines[k]
+		if reg, ok := register(a.operands[0]); ok && b.operands[0] == a.operands[0] &&
+			c.mnemonic == "push" && c.operands[0] == a.operands[0] && regDeadAfter(lines, k, reg) {
+			lines[i] = newAsmLine("%v qword [rsp]", b.mnemonic)
+			return remove(j, k)
+		}
+	}
+	return false
+}
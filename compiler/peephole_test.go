@@ -0,0 +1,112 @@
+package compiler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"push and pop of the same register", []string{"push rax", "pop rax", "ret"}, []string{"ret"}},
+		{"push and pop into another register", []string{"push rax", "pop rbx", "ret"}, []string{"mov rbx, rax", "ret"}},
+		{"pop and push of a dead register", []string{"pop rax", "push rax", "ret"}, []string{"ret"}},
+		{"pop and push of a live register", []string{"pop rax", "push rax", "add rbx, rax"}, []string{"pop rax", "push rax", "add rbx, rax"}},
+		{"push imm32", []string{"mov rax, 5", "push rax", "ret"}, []string{"push 5", "ret"}},
+		{"push negative imm32", []string{"mov rax, -2147483648", "push rax", "ret"}, []string{"push -2147483648", "ret"}},
+		{"push immediate wider than 32 bits", []string{"mov rax, 2147483648", "push rax", "ret"}, []string{"mov rax, 2147483648", "push rax", "ret"}},
+		{"push imm32 of a live register", []string{"mov rax, 5", "push rax", "push rax"}, []string{"mov rax, 5", "push rax", "push rax"}},
+		{"inc", []string{"mov rbx, 1", "add rax, rbx", "ret"}, []string{"inc rax", "ret"}},
+		{"dec", []string{"mov rbx, 1", "sub rax, rbx", "ret"}, []string{"dec rax", "ret"}},
+		{"inc of the same register", []string{"mov rax, 1", "add rax, rax", "ret"}, []string{"mov rax, 1", "add rax, rax", "ret"}},
+		{"cmp imm32", []string{"mov rbx, 7", "cmp rax, rbx", "ret"}, []string{"cmp rax, 7", "ret"}},
+		{"inc through a pop", []string{"mov rax, 1", "pop rbx", "add rax, rbx", "push rax", "ret"}, []string{"inc qword [rsp]", "ret"}},
+		{"dec through a pop", []string{"mov rax, 1", "pop rbx", "sub rbx, rax", "push rbx", "ret"}, []string{"dec qword [rsp]", "ret"}},
+		{
+			"inc through a pop of a live register",
+			[]string{"mov rax, 1", "pop rbx", "add rax, rbx", "push rax", "push rbx"},
+			[]string{"mov rax, 1", "pop rbx", "add rax, rbx", "push rax", "push rbx"},
+		},
+		{
+			"dec through a pop of a live register",
+			[]string{"mov rax, 1", "pop rbx", "sub rbx, rax", "push rbx", "push rax"},
+			[]string{"mov rax, 1", "pop rbx", "sub rbx, rax", "push rbx", "push rax"},
+		},
+		{"inc on the stack", []string{"pop rax", "inc rax", "push rax", "ret"}, []string{"inc qword [rsp]", "ret"}},
+		{
+			// the inc rewrite completes the pattern that starts at the pop before it
+			"rewrite within the window",
+			[]string{"pop rax", "mov rbx, 1", "add rax, rbx", "push rax", "ret"},
+			[]string{"inc qword [rsp]", "ret"},
+		},
+		{
+			"rewrites that chain back",
+			[]string{"push rax", "push rbx", "pop rbx", "pop rcx", "ret"},
+			[]string{"mov rcx, rax", "ret"},
+		},
+		{"label between the instructions", []string{"push rax", "main_b1:", "pop rax"}, []string{"push rax", "main_b1:", "pop rax"}},
+		{"comment between the instructions", []string{"push rax", ";; drop", "pop rax", "ret"}, []string{";; drop", "ret"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := peephole(strings.Join(test.in, "\n") + "\n")
+			got := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			if len(test.want) == 0 {
+				test.want = []string{""}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRegDeadAfter(t *testing.T) {
+	filler := func(n int, last string) []string {
+		lines := []string{"mov rax, 1"}
+		for range n {
+			lines = append(lines, "mov rbx, 2")
+		}
+		return append(lines, last)
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		want  bool
+	}{
+		{"read", []string{"mov rax, 1", "add rbx, rax"}, false},
+		{"read in an address", []string{"mov rax, 1", "mov rbx, [rax]"}, false},
+		{"read of a sub register", []string{"mov rax, 1", "push rbx", "movzx rbx, al"}, false},
+		{"overwritten", []string{"mov rax, 1", "mov rax, 2", "push rax"}, true},
+		{"cleared", []string{"mov rax, 1", "xor rax, rax", "push rax"}, true},
+		{"end of the code", []string{"mov rax, 1"}, true},
+		{"ret", []string{"mov rax, 1", "ret", "push rax"}, true},
+		{"block label", []string{"mov rax, 1", "main_b2:", "push rax"}, true},
+		{"other label", []string{"mov rax, 1", "print:", "push rax"}, false},
+		{"jmp to a block", []string{"mov rax, 1", "jmp main_b2", "push rax"}, true},
+		{"jmp elsewhere", []string{"mov rax, 1", "jmp print", "mov rax, 2"}, false},
+		{"conditional jump to a block", []string{"mov rax, 1", "jz main_b2", "mov rax, 2"}, true},
+		{"read after a conditional jump to a block", []string{"mov rax, 1", "jz main_b2", "push rax"}, false},
+		{"conditional jump elsewhere", []string{"mov rax, 1", "jz print", "mov rax, 2"}, false},
+		{"syscall reads it", []string{"mov rax, 1", "syscall"}, false},
+		{"print clobbers it", []string{"mov rax, 1", "mov rdi, 2", "call print"}, true},
+		{"unknown instruction", []string{"mov rax, 1", "cqo"}, false},
+		{"overwritten at the scan limit", filler(regDeadScanLimit-1, "mov rax, 2"), true},
+		{"overwritten past the scan limit", filler(regDeadScanLimit, "mov rax, 2"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lines []asmLine
+			for _, text := range test.lines {
+				lines = append(lines, parseAsmLine(text))
+			}
+			if got := regDeadAfter(lines, 0, "rax"); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package compiler
+
+import "fmt"
+
+// cacheRegisters hold the top elements of the data stack, they are not
+// touched by the `print` runtime routine or by syscalls
+var cacheRegisters = []string{"r12", "r13", "r14"}
+
+// stackCache tracks which registers hold the top of the data stack during
+// code generation, regs[len(regs)-1] is the top and everything below
+// regs[0] is on the machine stack. The cache is empty at every block
+// boundary so that blocks agree on where the stack lives
+type stackCache struct {
+	regs []string
+	// registers popped by the instruction being compiled, they can not be
+	// handed out until the instruction is done
+	held []string
+}
+
+func (c *stackCache) depth() uint64 {
+	return uint64(len(c.regs))
+}
+
+func (c *stackCache) inUse(reg string) bool {
+	for _, r := range c.regs {
+		if r == reg {
+			return true
+		}
+	}
+	for _, r := range c.held {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
+
+// alloc returns a free register, spilling the bottom of the cache to
+// the machine stack when all of them are taken
+func (c *stackCache) alloc(code *string) string {
+	for _, reg := range cacheRegisters {
+		if !c.inUse(reg) {
+			c.held = append(c.held, reg)
+			return reg
+		}
+	}
+	assert(len(c.regs) > 0, "no register left to spill in stackCache.alloc")
+	reg := c.regs[0]
+	c.regs = c.regs[1:]
+	*code += fmt.Sprintf("push %v\n", reg)
+	c.held = append(c.held, reg)
+	return reg
+}
+
+// pop returns the register holding the top of the stack, loading it from
+// the machine stack when nothing is cached
+func (c *stackCache) pop(code *string) string {
+	if n := len(c.regs); n > 0 {
+		reg := c.regs[n-1]
+		c.regs = c.regs[:n-1]
+		c.held = append(c.held, reg)
+		return reg
+	}
+	reg := c.alloc(code)
+	*code += fmt.Sprintf("pop %v\n", reg)
+	return reg
+}
+
+// push makes reg the new top of the stack, reg has to come from pop or alloc
+func (c *stackCache) push(reg string) {
+	for i, r := range c.held {
+		if r == reg {
+			c.held = append(c.held[:i], c.held[i+1:]...)
+			c.regs = append(c.regs, reg)
+			return
+		}
+	}
+	assert(false, "push of a register that is not held in stackCache.push")
+}
+
+// release frees the registers popped by the finished instruction
+func (c *stackCache) release() {
+	c.held = c.held[:0]
+}
+
+// flush spills the cached elements to the machine stack
+func (c *stackCache) flush(code *string) {
+	for _, reg := range c.regs {
+		*code += fmt.Sprintf("push %v\n", reg)
+	}
+	c.regs = c.regs[:0]
+}
@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStackCache(t *testing.T) {
+	var c stackCache
+	var code string
+	for range cacheRegisters {
+		c.push(c.alloc(&code))
+		c.release()
+	}
+	if code != "" {
+		t.Errorf("filling the cache emitted %q", code)
+	}
+	// the bottom of the cache is spilled for a fourth value
+	reg := c.alloc(&code)
+	c.push(reg)
+	c.release()
+	if reg != "r12" || code != "push r12\n" {
+		t.Errorf("got %v after %q, want r12 after a spill of r12", reg, code)
+	}
+	if got := strings.Join(c.regs, " "); got != "r13 r14 r12" {
+		t.Errorf("got cache %v, want r13 r14 r12", got)
+	}
+	code = ""
+	c.flush(&code)
+	if code != "push r13\npush r14\npush r12\n" || c.depth() != 0 {
+		t.Errorf("flush emitted %q and left %v registers", code, c.depth())
+	}
+	// an empty cache is filled from the machine stack
+	code = ""
+	if reg := c.pop(&code); reg != "r12" || code != "pop r12\n" {
+		t.Errorf("got %v after %q, want r12 after a fill", reg, code)
+	}
+}
+
+// stripAsm drops the comments and line directives of the generated code
+func stripAsm(code string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(code, "\n") {
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "%") {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestStackCacheSpills(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		want   string
+		output string
+		exit   int
+	}{
+		{
+			"fourth value",
+			"1 2 3 4 print print print print\n",
+			"mov r14, 3\npush r12\nmov r12, 4\n",
+			"4\n3\n2\n1\n", 0,
+		},
+		{
+			"loop head",
+			"1 2 3 for dup 5 < do 1 + end print print print\n",
+			"mov r14, 3\npush r12\npush r13\npush r14\nmain_b1:\npop r12\n",
+			"5\n2\n1\n", 0,
+		},
+		{
+			"back edge",
+			"1 2 3 for dup 5 < do 1 + end print print print\n",
+			"add r13, r12\npush r13\njmp main_b1\n",
+			"5\n2\n1\n", 0,
+		},
+		{
+			"branch",
+			"1 2 3 < if 5 print end print\n",
+			"push r12\ncmp r13, r14\njge main_b2\nmain_b1:\nmov r12, 5\n",
+			"5\n1\n", 0,
+		},
+		{
+			"print",
+			"1 2 3 print print print\n",
+			"push r12\npush r13\nmov rdi, r14\ncall print\npop r12\n",
+			"3\n2\n1\n", 0,
+		},
+		{
+			"syscall",
+			"1 2 3 60 syscall1\n",
+			"push r13\npush r14\npush r12\npop rax\npop rdi\nsyscall\n",
+			"", 3,
+		},
+		{
+			"quote call",
+			"1 2 [ ( int -- int ) 3 + ] call print print\n",
+			"mov r14, quote_0\npush r12\npush r13\ncall r14\npop r12\n",
+			"5\n1\n", 0,
+		},
+		{
+			"quote entry",
+			"1 2 [ ( int -- int ) 3 + ] call print print\n",
+			"pop qword [r15]\nquote_0_b0:\nmov r12, 3\npop r13\nadd r13, r12\npush r13\n",
+			"5\n1\n", 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, diags := Compile(test.src, Options{FilePath: "test.dodo", NoPeephole: true})
+			if HasErrors(diags) {
+				t.Fatalf("unexpected diagnostics %v", diags)
+			}
+			code := stripAsm(result.Code)
+			if !strings.Contains(code, test.want) {
+				t.Errorf("the code has no\n%v\nin\n%v", test.want, code)
+			}
+			if out, exit := runProgram(t, result.Code); out != test.output || exit != test.exit {
+				t.Errorf("got output %q and exit code %v, want %q and %v", out, exit, test.output, test.exit)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package compiler
+
+// linuxSyscall is a syscall of the x86-64 linux ABI, dodo programs use these
+// numbers on every target and the backends map them to the native ones
+type linuxSyscall struct {
+	Number uint64
+	Name   string
+	// number on arm64, -1 when arm64 does not have the syscall
+	Arm64 int64
+}
+
+var linuxSyscalls = []linuxSyscall{
+	{0, "read", 63},
+	{1, "write", 64},
+	{2, "open", -1},
+	{3, "close", 57},
+	{4, "stat", -1},
+	{5, "fstat", 80},
+	{8, "lseek", 62},
+	{9, "mmap", 222},
+	{11, "munmap", 215},
+	{12, "brk", 214},
+	{16, "ioctl", 29},
+	{21, "access", -1},
+	{22, "pipe", -1},
+	{32, "dup", 23},
+	{35, "nanosleep", 101},
+	{39, "getpid", 172},
+	{57, "fork", -1},
+	{59, "execve", 221},
+	{60, "exit", 93},
+	{61, "wait4", 260},
+	{62, "kill", 129},
+	{63, "uname", 160},
+	{79, "getcwd", 17},
+	{80, "chdir", 49},
+	{83, "mkdir", -1},
+	{84, "rmdir", -1},
+	{87, "unlink", -1},
+	{96, "gettimeofday", 169},
+	{102, "getuid", 174},
+	{231, "exit_group", 94},
+	{257, "openat", 56},
+}
@@ -0,0 +1,152 @@
+package compiler
+
+import (
+	"log"
+)
+
+type Location struct {
+	Line     uint
+	Col      uint
+	FilePath string
+}
+
+type StringToken struct {
+	Content string
+	Loc     Location
+}
+
+type TokenType uint
+
+const (
+	TokenInt = iota
+	TokenBool
+	TokenPtr
+	TokenPlus
+	TokenSub
+	TokenMult
+	TokenDivMod
+	TokenWord
+	TokenPrint
+	TokenSwap
+	TokenDup
+	TokenDrop
+	TokenMacro
+	TokenMacroEnd
+	TokenTrue
+	TokenFalse
+	TokenEq
+	TokenGt
+	TokenLt
+	TokenLe
+	TokenGe
+	TokenFor
+	TokenDo
+	TokenIf
+	TokenElse
+	TokenEnd
+	TokenSyscall1
+	TokenSyscall3
+	TokenRot
+	TokenVar
+	TokenRead
+	TokenWrite
+	TokenQuote
+	TokenQuoteEnd
+	TokenCall
+	TokenLet
+	TokenIn
+	TokenLocal
+	TokenAssert
+	TokenExtern
+	TokenExport
+	TokenCount
+)
+
+type Token struct {
+	Type    TokenType
+	Kind    TokenType
+	Loc     Location
+	Operand uint64
+	// Block is the id of the `if`, `for` or `let` block that the keyword
+	// opens, continues or closes, and Jump is the index of the next keyword
+	// of the block in the same body, the `end` points back at the opening one
+	Block int
+	Jump  int
+}
+
+// Macro is expanded in place wherever its name is used, when it has a
+// declared stack effect the call sites are checked against it instead of the body
+type Macro struct {
+	Body     []Token
+	Effect   StackEffect
+	Declared bool
+	Loc      Location
+}
+
+// Quote is the body of a `[ ... ]` block, compiled once as an anonymous
+// routine and referenced by its index in the quote table
+type Quote struct {
+	Body     []Token
+	Effect   StackEffect
+	Declared bool
+	Loc      Location
+	// C symbol of a quote defined by `export <name> [ ... ]`
+	Export string
+}
+
+// Extern is a C function declared with `extern <name> ( <sig> )`, its
+// inputs are passed in the SysV argument registers and its output in rax
+type Extern struct {
+	Name   string
+	Effect StackEffect
+	Loc    Location
+}
+
+// cArgRegisters are the SysV registers of the integer arguments of a C call
+var cArgRegisters = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+
+// reservedSymbols are the labels of the generated code that an `extern` or `export` cannot take
+var reservedSymbols = map[string]bool{
+	"_start": true, "main": true, "print": true, "print_render": true, "print_reverse": true,
+	"print_buffer": true, "runtime_error": true, "vars_buffer": true, "ret_stack": true,
+	"ret_stack_end": true, "ret_stack_top": true, "stack_base": true,
+}
+
+func (c *compiler) lookupExtern(name string) (int, bool) {
+	for id, extern := range c.externs {
+		if extern.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+type CompileState struct {
+	varBufSize uint64
+	varOffset  uint64
+	Checked    bool
+	DebugStack bool
+	Peephole   bool
+	// registers holding the top of the data stack while a block is compiled
+	cache stackCache
+	// building an object file that is linked into a C program
+	Object bool
+	// messages printed by failing runtime checks, emitted into `.data`
+	RuntimeMsgs []string
+	// comment the generated assembly with the tokens it comes from
+	Annotate       bool
+	AnnotateSource bool
+	SourceLines    []string
+	TokenText      map[Location]string
+	// last source line interleaved into the assembly
+	annotatedLine uint
+	// C functions of the program, indexed by the operand of `OpCallExtern`
+	externs []Extern
+}
+
+func assert(cond bool, msg string) {
+	if !cond {
+		log.Println(msg)
+		panic(1)
+	}
+}
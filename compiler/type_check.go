@@ -0,0 +1,861 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type TypeStack []TypeInfo
+
+func (ts *TypeStack) push(t TypeInfo) {
+	*ts = append(*ts, t)
+}
+
+// pop removes the top of the stack, popping an empty stack after an
+// underflow has been reported returns an unknown value
+func (ts *TypeStack) pop() TypeInfo {
+	if len(*ts) == 0 {
+		return unknownType
+	}
+	t := (*ts)[len(*ts)-1]
+	*ts = (*ts)[:len(*ts)-1]
+	return t
+}
+
+func (ts TypeStack) len() uint {
+	return uint(len(ts))
+}
+
+func (ts TypeStack) clone() TypeStack {
+	return append(TypeStack(nil), ts...)
+}
+
+func (ts TypeStack) equals(other TypeStack) bool {
+	if len(ts) != len(other) {
+		return false
+	}
+	for i := range ts {
+		if !ts[i].equals(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ts TypeStack) String() string {
+	var sb strings.Builder
+	sb.WriteString("<")
+	for _, t := range ts {
+		sb.WriteString(" ")
+		sb.WriteString(typeName(t.Type))
+	}
+	sb.WriteString(" >")
+	return sb.String()
+}
+
+// apply checks that the inputs of effect are on top of the stack
+// and replaces them with its outputs, on a mismatch the stack is left
+// untouched and the reason is returned
+func (ts *TypeStack) apply(effect StackEffect) (string, bool) {
+	ins := TypeStack(effect.Ins)
+	if ts.len() < ins.len() {
+		return fmt.Sprintf("expected %v found %v elements on the stack", ins, ts.len()), false
+	}
+	args := (*ts)[ts.len()-ins.len():]
+	if !args.equals(ins) {
+		return fmt.Sprintf("expected %v found %v on the stack", ins, args), false
+	}
+	*ts = (*ts)[:ts.len()-ins.len()]
+	*ts = append(*ts, effect.Outs...)
+	return "", true
+}
+
+// force replaces the inputs of effect with its outputs regardless of their
+// types, to go on checking after apply has failed
+func (ts *TypeStack) force(effect StackEffect) {
+	*ts = (*ts)[:ts.len()-min(ts.len(), uint(len(effect.Ins)))]
+	*ts = append(*ts, effect.Outs...)
+}
+
+type TypeInfo struct {
+	Type   TokenType
+	Kind   TokenType
+	Effect *StackEffect // stack effect of a TokenQuote
+}
+
+// typeUnknown is the type of a value the checker lost track of after an
+// error, it matches every type so that the error is not reported again
+const typeUnknown TokenType = TokenCount
+
+var unknownType = TypeInfo{Type: typeUnknown, Kind: typeUnknown}
+
+// is reports whether t is one of types
+func (t TypeInfo) is(types ...TokenType) bool {
+	return t.Type == typeUnknown || slices.Contains(types, t.Type)
+}
+
+func (t TypeInfo) equals(other TypeInfo) bool {
+	if t.Type == typeUnknown || other.Type == typeUnknown {
+		return true
+	}
+	if t.Type != other.Type {
+		return false
+	}
+	if t.Type == TokenQuote {
+		return t.Effect.equals(*other.Effect)
+	}
+	return true
+}
+
+// StackEffect is the `( ins -- outs )` signature of a quote or a macro
+type StackEffect struct {
+	Ins  []TypeInfo
+	Outs []TypeInfo
+	Loc  Location
+	// the effect of a quote could not be inferred as its body has errors
+	Unknown bool
+}
+
+func (e StackEffect) equals(other StackEffect) bool {
+	return TypeStack(e.Ins).equals(other.Ins) && TypeStack(e.Outs).equals(other.Outs)
+}
+
+func (e StackEffect) String() string {
+	var sb strings.Builder
+	sb.WriteString("(")
+	for _, t := range e.Ins {
+		sb.WriteString(" " + typeName(t.Type))
+	}
+	sb.WriteString(" --")
+	for _, t := range e.Outs {
+		sb.WriteString(" " + typeName(t.Type))
+	}
+	sb.WriteString(" )")
+	return sb.String()
+}
+
+// typeName is how a type is written in the source
+func typeName(t TokenType) string {
+	switch t {
+	case TokenQuote:
+		return "quote"
+	case typeUnknown:
+		return "?"
+	}
+	for name, kind := range tokenKindStr {
+		if kind == t {
+			return name
+		}
+	}
+	return intrinsicStr[t]
+}
+
+type typeBlock struct {
+	Token   Token
+	Entry   TypeStack // stack at `for` or after `if`
+	AfterDo TypeStack
+	Branch  TypeStack // stack at `else`
+	HasElse bool
+	HasDo   bool
+}
+
+// typeCheck checks the macros with a declared effect, the quotes and the
+// program. The check goes on after an error with the stack the failing
+// word would have left, it only stops the body it is in when the stack
+// cannot be known anymore, like after an undefined word
+func (c *compiler) typeCheck(strTokens []StringToken, tokens []Token) {
+	macroNames := make([]string, 0, len(c.macros))
+	for name := range c.macros {
+		macroNames = append(macroNames, name)
+	}
+	// check macros in the order they are defined so errors are reported deterministically
+	sort.Slice(macroNames, func(i, j int) bool {
+		a, b := c.macros[macroNames[i]].Loc, c.macros[macroNames[j]].Loc
+		return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+	})
+	for _, name := range macroNames {
+		if macro := c.macros[name]; macro.Declared {
+			c.typeCheckMacro(strTokens, name, macro)
+		}
+	}
+	for id := range c.quotes {
+		c.typeCheckQuote(strTokens, id)
+	}
+	var stack, locals TypeStack
+	c.typeCheckTokens(strTokens, tokens, &stack, &locals)
+}
+
+// typeCheckQuote checks the body of a quote against its declared stack effect,
+// or infers the effect when there is no declaration
+func (c *compiler) typeCheckQuote(strTokens []StringToken, id int) {
+	quote := &c.quotes[id]
+	stack := TypeStack(quote.Effect.Ins).clone()
+	var locals TypeStack
+	errors := c.diags.count(SeverityError)
+	if !c.typeCheckTokens(strTokens, quote.Body, &stack, &locals) || c.diags.count(SeverityError) > errors {
+		// calls of the quote cannot be checked without its effect
+		quote.Effect.Unknown = !quote.Declared
+		return
+	}
+	if !quote.Declared {
+		quote.Effect.Outs = stack
+		return
+	}
+	if !stack.equals(quote.Effect.Outs) {
+		c.diags.errorf(quote.Loc, ErrEffectMismatch, "quotation declared as %v but leaves %v on the stack", quote.Effect, stack).
+			notef(quote.Effect.Loc, "stack effect declared here")
+	}
+}
+
+// typeCheckMacro verifies the body of a macro against its declared
+// stack effect once, so call sites only have to be checked against the effect
+func (c *compiler) typeCheckMacro(strTokens []StringToken, name string, macro Macro) {
+	stack := TypeStack(macro.Effect.Ins).clone()
+	var locals TypeStack
+	errors := c.diags.count(SeverityError)
+	c.expanding[name] = true
+	known := c.typeCheckTokens(strTokens, macro.Body, &stack, &locals)
+	delete(c.expanding, name)
+	if !known || c.diags.count(SeverityError) > errors {
+		// the stack left by a body with errors is not compared
+		return
+	}
+	if !stack.equals(macro.Effect.Outs) {
+		end := macro.Body[len(macro.Body)-1]
+		c.diags.errorf(
+			end.Loc,
+			ErrEffectMismatch,
+			"macro `%v` leaves %v on the stack but is declared as %v",
+			name,
+			stack,
+			macro.Effect,
+		).notef(macro.Effect.Loc, "`%v` declared here", name)
+	}
+}
+
+// typeCheckTokens checks tokens on top of the stack at stackPtr and leaves
+// the stack after them there, it returns false when it had to stop as the
+// stack cannot be known anymore
+// locals mirrors the frames of `let` bindings on the return stack,
+// the binding in slot n is at locals[len(locals)-1-n]
+func (c *compiler) typeCheckTokens(strTokens []StringToken, tokens []Token, stackPtr *TypeStack, locals *TypeStack) bool {
+	stack := *stackPtr
+	defer func() { *stackPtr = stack }()
+	var blocks []typeBlock
+	assert(TokenCount == 41, "Exhaustive switch case for typeCheck")
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token.Type {
+		case TokenInt:
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+		case TokenPlus:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 ints found < %v %v > on the stack",
+					typeName(b.Type),
+					typeName(a.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+		case TokenSub:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 ints found < %v %v > on the stack",
+					typeName(b.Type),
+					typeName(a.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+		case TokenMult:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 ints found < %v %v > on the stack",
+					typeName(b.Type),
+					typeName(a.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+		case TokenPrint:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 int found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenInt, TokenPtr, TokenBool) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 ints or ptr found < %v > on the stack",
+					typeName(a.Type),
+				)
+			}
+		case TokenDivMod:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(token, ErrStackUnderflow, "expected atleast 2 ints")
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 ints found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+			stack.push(TypeInfo{Type: TokenInt, Kind: TokenInt})
+		case TokenSwap:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 elements found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			stack.push(a)
+			stack.push(b)
+		case TokenDup:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 elements found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			stack.push(a)
+			stack.push(a)
+		case TokenDrop:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 elements found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			stack.pop()
+		case TokenRot:
+			if stack.len() < 3 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 3 elements found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			c := stack.pop()
+			b := stack.pop()
+			a := stack.pop()
+			stack.push(b)
+			stack.push(c)
+			stack.push(a)
+		case TokenTrue:
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenFalse:
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenGt:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 bools found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenGe:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 bools found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenLt:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 bools found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenLe:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 bools found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenEq:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 ints found %v elements on the stack",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			b := stack.pop()
+			if !b.is(TokenInt) && !a.is(TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 2 bools found < %v %v > on the stack",
+					typeName(a.Type),
+					typeName(b.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: TokenBool, Kind: TokenBool})
+		case TokenFor:
+			blocks = append(blocks, typeBlock{Token: token, Entry: stack.clone()})
+		case TokenDo:
+			assert(len(blocks) > 0 && blocks[len(blocks)-1].Token.Block == token.Block, "`do` without `for` in typeCheck, this should have been caught by the parser")
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 bool got %v elements",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenBool, TokenInt) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 bools found < %v > on the stack",
+					typeName(a.Type),
+				)
+			}
+			blocks[len(blocks)-1].AfterDo = stack.clone()
+			blocks[len(blocks)-1].HasDo = true
+		case TokenIf:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 bool got %v elements",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenBool) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 bools found < %v > on the stack",
+					typeName(a.Type),
+				)
+			}
+			blocks = append(blocks, typeBlock{
+				Token:   token,
+				Entry:   stack.clone(),
+				HasElse: tokens[token.Jump].Type == TokenElse,
+			})
+		case TokenElse:
+			assert(len(blocks) > 0 && blocks[len(blocks)-1].Token.Block == token.Block, "`else` without `if` in typeCheck, this should have been caught by the parser")
+			block := &blocks[len(blocks)-1]
+			block.Branch = stack
+			stack = block.Entry.clone()
+		case TokenEnd:
+			assert(len(blocks) > 0 && blocks[len(blocks)-1].Token.Block == token.Block, "`end` without a block in typeCheck, this should have been caught by the parser")
+			block := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			// the parser closed a block that is never closed and has reported
+			// it, its stacks are not compared as the end is made up
+			synthetic := token.Loc == block.Token.Loc
+			switch block.Token.Type {
+			case TokenIf:
+				expected := block.Entry
+				if block.HasElse {
+					expected = block.Branch
+				}
+				if !synthetic && !stack.equals(expected) {
+					c.reportIntrinsicError(
+						token,
+						ErrBranchMismatch,
+						"branches of `if` leave different stacks %v and %v",
+						expected,
+						stack,
+					).notef(block.Token.Loc, "block opened here")
+				}
+			case TokenFor:
+				if !block.HasDo {
+					// a `for` without `do`, which the parser has reported
+					stack = block.Entry
+					break
+				}
+				if !synthetic && !stack.equals(block.Entry) {
+					c.reportIntrinsicError(
+						token,
+						ErrLoopChangesStack,
+						"body of `for` changes the stack from %v to %v",
+						block.Entry,
+						stack,
+					).notef(block.Token.Loc, "loop opened here")
+				}
+				stack = block.AfterDo
+			case TokenLet:
+				*locals = (*locals)[:locals.len()-uint(block.Token.Operand)]
+			}
+		case TokenRead:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 ptr found %v elements",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenPtr) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 ptr found < %v > on the stack",
+					typeName(a.Type),
+				)
+			}
+			stack.push(TypeInfo{Type: a.Kind, Kind: a.Kind})
+		case TokenWrite:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 ptr and 1 int found %v element(s)",
+					stack.len(),
+				)
+			}
+			value := stack.pop()
+			varr := stack.pop()
+			if !varr.is(TokenPtr) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 ptr and 1 int found < %v %v > on the stack",
+					typeName(value.Type),
+					typeName(varr.Type),
+				)
+			} else if varr.Kind != typeUnknown && !value.is(varr.Kind) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"trying to write a value of type %v into type variable %v",
+					typeName(value.Type),
+					typeName(varr.Kind),
+				)
+			}
+		case TokenSyscall1:
+			if stack.len() < 2 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 2 elements found %v elements",
+					stack.len(),
+				)
+			}
+			stack.pop()
+			stack.pop()
+		case TokenSyscall3:
+			if stack.len() < 4 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 4 elements found %v elements",
+					stack.len(),
+				)
+			}
+			for range 4 {
+				stack.pop()
+			}
+		case TokenLet:
+			n := uint(token.Operand)
+			if stack.len() < n {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"binds %v names but found %v elements on the stack",
+					n,
+					stack.len(),
+				)
+				for stack.len() < n {
+					stack = append(TypeStack{unknownType}, stack...)
+				}
+			}
+			// the first name ends up in slot 0, so the frame is pushed in reverse
+			bound := stack[stack.len()-n:]
+			for j := len(bound) - 1; j >= 0; j-- {
+				locals.push(bound[j])
+			}
+			stack = stack[:stack.len()-n]
+			blocks = append(blocks, typeBlock{Token: token})
+		case TokenAssert:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 bool got %v elements",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenBool) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 bools found < %v > on the stack",
+					typeName(a.Type),
+				)
+			}
+		case TokenIn:
+			c.reportIntrinsicError(token, ErrUnmatched, "without a matching `let`")
+		case TokenLocal:
+			stack.push((*locals)[locals.len()-1-uint(token.Operand)])
+		case TokenMacro:
+		case TokenVar:
+		case TokenExtern:
+		case TokenExport:
+		case TokenMacroEnd:
+		case TokenQuoteEnd:
+		case TokenQuote:
+			stack.push(
+				TypeInfo{
+					Type:   TokenQuote,
+					Kind:   TokenQuote,
+					Effect: &c.quotes[token.Operand].Effect,
+				},
+			)
+		case TokenCall:
+			if stack.len() < 1 {
+				c.reportIntrinsicError(
+					token,
+					ErrStackUnderflow,
+					"expected atleast 1 quotation found %v elements",
+					stack.len(),
+				)
+			}
+			a := stack.pop()
+			if !a.is(TokenQuote) {
+				c.reportIntrinsicError(
+					token,
+					ErrTypeMismatch,
+					"takes 1 quotation found < %v > on the stack",
+					typeName(a.Type),
+				)
+				return false
+			}
+			// the stack after calling a value that is not known, or a quote
+			// whose body has errors, cannot be known
+			if a.Type == typeUnknown || a.Effect.Unknown {
+				return false
+			}
+			if msg, ok := stack.apply(*a.Effect); !ok {
+				c.reportIntrinsicError(token, ErrEffectMismatch, "%v", msg)
+				stack.force(*a.Effect)
+			}
+		case TokenWord:
+			name := strTokens[token.Operand].Content
+			if c.undefined[int(token.Operand)] {
+				// an undefined word, which the parser has reported
+				return false
+			}
+			if id, found := c.lookupExtern(name); found {
+				extern := c.externs[id]
+				if msg, ok := stack.apply(extern.Effect); !ok {
+					c.diags.errorf(token.Loc, ErrEffectMismatch, "extern `%v` %v", name, msg).
+						notef(extern.Loc, "`%v` declared as %v here", name, extern.Effect)
+					stack.force(extern.Effect)
+				}
+				continue
+			}
+			if macro, found := c.macros[name]; found {
+				if c.expanding[name] {
+					c.reportRecursiveMacro(token, name, macro)
+					return false
+				}
+				if macro.Declared {
+					if msg, ok := stack.apply(macro.Effect); !ok {
+						c.diags.errorf(token.Loc, ErrEffectMismatch, "macro `%v` %v", name, msg).
+							notef(macro.Effect.Loc, "`%v` declared as %v here", name, macro.Effect)
+						stack.force(macro.Effect)
+					}
+					continue
+				}
+				c.expanding[name] = true
+				known := c.typeCheckTokens(strTokens, macro.Body, &stack, locals)
+				delete(c.expanding, name)
+				if !known {
+					return false
+				}
+				continue
+			}
+			_, found := c.vars[name]
+			assert(found, "undefined word in typeCheck, this should have been caught by the parser")
+			stack.push(
+				TypeInfo{
+					Type: TokenPtr,
+					Kind: c.vars[name].Kind,
+				},
+			)
+		}
+	}
+	assert(len(blocks) == 0, "unclosed block in typeCheck, this should have been caught by the parser")
+	return true
+}
+
+// reportRecursiveMacro records the use of a macro inside of its own expansion
+func (c *compiler) reportRecursiveMacro(token Token, name string, macro Macro) {
+	c.diags.errorf(token.Loc, ErrRecursiveMacro, "macro `%v` expands into itself", name).
+		notef(macro.Loc, "`%v` defined here", name)
+}
+
+// reportIntrinsicError records an error about the use of an intrinsic or keyword
+func (c *compiler) reportIntrinsicError(token Token, code Code, err string, args ...any) *Diagnostic {
+	assert(len(intrinsicStr) == TokenCount, "")
+	return c.diags.errorf(token.Loc, code, "`%v` %v", tokenName(token.Type), fmt.Sprintf(err, args...))
+}
+
+var intrinsicStr = map[TokenType]string{
+	TokenInt:      "TokenInt",
+	TokenBool:     "TokenBool",
+	TokenPtr:      "TokenPtr",
+	TokenPlus:     "TokenPlus",
+	TokenSub:      "TokenSub",
+	TokenMult:     "TokenMult",
+	TokenDivMod:   "TokenDivMod",
+	TokenPrint:    "TokenPrint",
+	TokenSwap:     "TokenSwap",
+	TokenDup:      "TokenDup",
+	TokenDrop:     "TokenDrop",
+	TokenRot:      "TokenRot",
+	TokenGt:       "TokenGt",
+	TokenGe:       "TokenGe",
+	TokenLt:       "TokenLt",
+	TokenLe:       "TokenLe",
+	TokenEq:       "TokenEq",
+	TokenFor:      "TokenFor",
+	TokenDo:       "TokenDo",
+	TokenIf:       "TokenIf",
+	TokenElse:     "TokenElse",
+	TokenEnd:      "TokenEnd",
+	TokenSyscall1: "TokenSyscall1",
+	TokenSyscall3: "TokenSyscall3",
+	TokenMacro:    "TokenMacro",
+	TokenMacroEnd: "TokenMacroEnd",
+	TokenVar:      "TokenVar",
+	TokenRead:     "TokenRead",
+	TokenWrite:    "TokenWrite",
+	TokenWord:     "TokenWord",
+	TokenTrue:     "TokenTrue",
+	TokenFalse:    "TokenFalse",
+	TokenQuote:    "TokenQuote",
+	TokenQuoteEnd: "TokenQuoteEnd",
+	TokenCall:     "TokenCall",
+	TokenLet:      "TokenLet",
+	TokenIn:       "TokenIn",
+	TokenLocal:    "TokenLocal",
+	TokenAssert:   "TokenAssert",
+	TokenExtern:   "TokenExtern",
+	TokenExport:   "TokenExport",
+}
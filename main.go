@@ -8,79 +8,47 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-)
 
-var (
-	globalVarsTable  = make(map[string]Token, 100)
-	globalMacroTable = make(map[string][]Token, 100)
+	"github.com/siiickok/dodolang/compiler"
 )
 
-type Location struct {
-	Line     uint
-	Col      uint
-	FilePath string
-}
-
-type StringToken struct {
-	Content string
-	Loc     Location
-}
-
-type TokenType uint
-
-const (
-	TokenInt = iota
-	TokenBool
-	TokenPtr
-	TokenPlus
-	TokenSub
-	TokenMult
-	TokenDivMod
-	TokenWord
-	TokenPrint
-	TokenSwap
-	TokenDup
-	TokenDrop
-	TokenMacro
-    TokenMacroEnd
-    TokenTrue
-    TokenFalse
-	TokenEq
-	TokenGt
-	TokenLt
-	TokenLe
-	TokenGe
-	TokenFor
-	TokenDo
-	TokenIf
-	TokenElse
-	TokenEnd
-	TokenSyscall1
-	TokenSyscall3
-	TokenRot
-	TokenVar
-	TokenRead
-	TokenWrite
-	TokenCount
-)
-
-type Token struct {
-	Type    TokenType
-	Kind    TokenType
-	Loc     Location
-	Operand uint64
-}
-
 func main() {
+	checked := flag.Bool("checked", false, "trap division by zero in `divmod` with the location of the offending token")
+	debugStack := flag.Bool("debug-stack", false, "check the depth of the data stack at runtime and report underflows and overflows with their location")
+	optimize := flag.Bool("O", false, "fold literal arithmetic and comparisons and remove branches on literal conditions")
+	noPeephole := flag.Bool("no-peephole", false, "disable the peephole optimizer over the generated assembly")
+	emit := flag.String("emit", "exe", "what to build, `exe`, `asm` which stops after writing the assembly, `obj` which stops after assembling it, `c` which writes a C translation of the program, `wat` which writes a WebAssembly text module for WASI or `llvm` which writes LLVM IR")
+	arch := flag.String("arch", "x86_64", "target architecture, `x86_64` or `arm64` (which is built with `aarch64-linux-gnu-as` and `aarch64-linux-gnu-ld`)")
+	asmSyntax := flag.String("asm", "nasm", "syntax of the generated assembly, `nasm` or `gas` (which is built with `as` and `ld`)")
+	assembler := flag.String("assembler", "native", "assembler used to build the executable, `native` or `nasm` (which also needs `ld`)")
+	debugInfo := flag.Bool("g", false, "keep the debug info that maps the executable to the `.dodo` source for gdb, the built-in assembler does not write it so executables are built with `as` and `ld` instead")
+	annotate := flag.Bool("annotate", false, "precede the assembly of every token with its location and text, and the call site of the macro it was expanded from")
+	annotateSource := flag.Bool("annotate-source", false, "like -annotate, and also interleave the source lines into the assembly")
+	outPath := flag.String("o", "", "path of the built file, by default it is named after the source file")
+	outDir := flag.String("out-dir", "", "directory for the built file and the intermediate files, by default the directory of the source file")
+	keepIntermediates := flag.Bool("keep-intermediates", false, "keep the assembly and object files that the executable is built from")
+	nasmPath := flag.String("nasm", "nasm", "path of nasm for `--assembler=nasm`")
+	ldPath := flag.String("ld", "ld", "path of the linker for `--assembler=nasm` and `--asm=gas`")
+	errorFormat := flag.String("error-format", "human", "how diagnostics are written, `human` or `json` for editors and CI")
 	flag.Parse()
 
 	flag.Usage = func() {
 		fmt.Printf("Usage of %s:\n", os.Args[0])
 		fmt.Println("    build <source file>")
 		fmt.Println("        build: compile file")
+		fmt.Println("    test [-update] [-j <jobs>] [<file or directory>...]")
+		fmt.Println("        test: build and run the programs and compare their stdout and exit code with the expected ones")
 		flag.PrintDefaults()
 	}
 	subCom := flag.Arg(0)
+	if subCom == "test" {
+		os.Exit(runTests(flag.Args()[1:], compiler.Options{
+			Checked:    *checked,
+			DebugStack: *debugStack,
+			Optimize:   *optimize,
+			NoPeephole: *noPeephole,
+		}))
+	}
 	if subCom != "build" && subCom != "run" {
 		flag.Usage()
 		return
@@ -96,54 +64,211 @@ func main() {
 		return
 	}
 
+	switch *errorFormat {
+	case "human", "json":
+	default:
+		fmt.Printf("unknown error format `%v`, expected `human` or `json`\n", *errorFormat)
+		os.Exit(1)
+	}
+
+	switch *emit {
+	case "exe", "asm", "obj", "c", "wat", "llvm":
+	default:
+		fmt.Printf("unknown emit kind `%v`, expected `exe`, `asm`, `obj`, `c`, `wat` or `llvm`\n", *emit)
+		os.Exit(1)
+	}
+
+	switch *assembler {
+	case "native", "nasm":
+	default:
+		fmt.Printf("unknown assembler `%v`, expected `native` or `nasm`\n", *assembler)
+		os.Exit(1)
+	}
+
+	// the built-in assembler only writes executables and drops the source
+	// lines, so object files and executables with debug info are built from
+	// the gas syntax with `as` instead
+	if *arch == "x86_64" && *assembler == "native" && (*emit == "obj" || *debugInfo && *emit == "exe") {
+		*asmSyntax = "gas"
+	}
+
 	contentBytes, err := os.ReadFile(filePath)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	state := CompileState{}
-	content := string(contentBytes) + string(0)
-	strTokens := lexFile(content, filePath)
-	tokens := parseTokens(strTokens, &state)
-	if !typeCheck(strTokens, tokens) {
+	content := string(contentBytes)
+	opts := compiler.Options{
+		FilePath:       filePath,
+		Emit:           *emit,
+		Arch:           *arch,
+		Syntax:         *asmSyntax,
+		Object:         *emit == "obj",
+		Checked:        *checked,
+		DebugStack:     *debugStack,
+		Optimize:       *optimize,
+		NoPeephole:     *noPeephole,
+		Annotate:       *annotate,
+		AnnotateSource: *annotateSource,
+	}
+	// executables and object files are assembled from the generated assembly
+	if *emit == "exe" || *emit == "obj" {
+		opts.Emit = "asm"
+	}
+	result, diags := compiler.Compile(content, opts)
+	if *errorFormat == "json" {
+		if err := compiler.WriteDiagnosticsJSON(os.Stdout, diags, filePath, content); err != nil {
+			log.Fatalln("ERROR:", err)
+		}
+	} else {
+		color := isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+		compiler.WriteDiagnostics(os.Stdout, diags, filePath, content, color)
+	}
+	if compiler.HasErrors(diags) {
 		os.Exit(1)
 	}
 
-	outPath := strings.TrimSuffix(filePath, filepath.Ext(filePath))
 	if subCom == "build" {
-		abs, err := filepath.Abs(outPath)
-		abs += ".asm"
+		if len(result.Externs) > 0 && *emit == "exe" {
+			fmt.Println("programs that call `extern` functions have to be linked with C code, pass `--emit=obj` and link the object with a C compiler")
+			os.Exit(1)
+		}
+		paths := newBuildPaths(filePath, *outPath, *outDir)
+		err := build(&paths, result.Code, buildConfig{
+			emit:      *emit,
+			arch:      *arch,
+			syntax:    *asmSyntax,
+			assembler: *assembler,
+			nasmPath:  *nasmPath,
+			ldPath:    *ldPath,
+		})
+		paths.cleanup(*keepIntermediates)
 		if err != nil {
 			log.Fatalln("ERROR:", err)
 		}
-		compileProgram(strTokens, tokens, &state, abs)
-		cmd := []string{"nasm", "-g", "-felf64", outPath + ".asm"}
-		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
-			log.Fatalln("ERROR:", err, cmd, string(out))
-		}
-		cmd = []string{"ld", outPath + ".o", "-o", outPath}
-		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
-			log.Fatalln("ERROR:", err, cmd, string(out))
-		}
 	} else {
 		fmt.Printf("Invalid subcommand `%v`\n", subCom)
 		flag.Usage()
 	}
 }
 
-type CompileState struct {
-	CmpCount    uint64
-	IfCount     uint64
-	ForCount    uint64
-	ForNest     uint64
-	IfNest      uint64
-	BranchCount uint64
-	varBufSize  uint64
-	varOffset   uint64
+// buildConfig selects the file that build writes and the tools it is built with
+type buildConfig struct {
+	emit      string
+	arch      string
+	syntax    string
+	assembler string
+	nasmPath  string
+	ldPath    string
+}
+
+// build writes the compiled code and assembles and links it when the target
+// needs it, the intermediate files are left in paths for the caller to remove
+// even when a step fails
+func build(paths *buildPaths, code string, config buildConfig) error {
+	switch config.emit {
+	case "c":
+		return writeFile(paths.output(".c", true), code, 0644)
+	case "wat":
+		return writeFile(paths.output(".wat", true), code, 0644)
+	case "llvm":
+		return writeFile(paths.output(".ll", true), code, 0644)
+	}
+	if config.arch == "arm64" || config.syntax == "gas" {
+		as, ld := "as", config.ldPath
+		if config.arch == "arm64" {
+			as, ld = "aarch64-linux-gnu-as", "aarch64-linux-gnu-ld"
+		}
+		sPath := paths.output(".s", config.emit == "asm")
+		if err := writeFile(sPath, code, 0644); err != nil || config.emit == "asm" {
+			return err
+		}
+		objPath := paths.output(".o", config.emit == "obj")
+		if err := runCommand(as, sPath, "-o", objPath); err != nil || config.emit == "obj" {
+			return err
+		}
+		return runCommand(ld, objPath, "-o", paths.output("", true))
+	}
+	asmPath := paths.output(".asm", config.emit == "asm")
+	if err := writeFile(asmPath, code, 0644); err != nil || config.emit == "asm" {
+		return err
+	}
+	if config.assembler == "native" {
+		exe, err := compiler.Assemble(code)
+		if err != nil {
+			return fmt.Errorf("%v:%v", asmPath, err)
+		}
+		return writeFile(paths.output("", true), string(exe), 0755)
+	}
+	objPath := paths.output(".o", config.emit == "obj")
+	if err := runCommand(config.nasmPath, "-g", "-felf64", asmPath, "-o", objPath); err != nil || config.emit == "obj" {
+		return err
+	}
+	return runCommand(config.ldPath, objPath, "-o", paths.output("", true))
+}
+
+// buildPaths names the files of a build, every file but the requested one is
+// an intermediate that is removed after the build
+type buildPaths struct {
+	// intermediates are named base with their extension
+	base          string
+	artifact      string
+	intermediates []string
+}
+
+func newBuildPaths(filePath string, outPath string, outDir string) buildPaths {
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	if outDir != "" {
+		base = filepath.Join(outDir, filepath.Base(base))
+	} else if outPath != "" {
+		base = strings.TrimSuffix(outPath, filepath.Ext(outPath))
+	}
+	for _, dir := range []string{filepath.Dir(base), filepath.Dir(outPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatalln("ERROR:", err)
+		}
+	}
+	return buildPaths{base: base, artifact: outPath}
+}
+
+// output returns the path of the file with extension ext, which is the
+// built file when artifact is true
+func (p *buildPaths) output(ext string, artifact bool) string {
+	if !artifact {
+		path := p.base + ext
+		p.intermediates = append(p.intermediates, path)
+		return path
+	}
+	if p.artifact == "" {
+		p.artifact = p.base + ext
+	}
+	return p.artifact
+}
+
+func (p *buildPaths) cleanup(keep bool) {
+	if keep {
+		return
+	}
+	// a failed build stops before it writes all of its intermediates
+	for _, path := range p.intermediates {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Fatalln("ERROR:", err)
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func writeFile(path string, content string, perm os.FileMode) error {
+	return os.WriteFile(path, []byte(content), perm)
 }
 
-func assert(cond bool, msg string) {
-	if !cond {
-		log.Println(msg)
-		panic(1)
+// runCommand runs an external tool of the build, the error holds its output
+func runCommand(cmd ...string) error {
+	if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %v %v", err, cmd, string(out))
 	}
+	return nil
 }
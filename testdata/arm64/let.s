@@ -0,0 +1,206 @@
+// -- Header --
+.text
+
+// print writes x0 as a decimal number and a newline to stdout
+print:
+ldr x1, =print_buffer+21
+mov x2, #10
+strb w2, [x1]
+mov x3, #1
+print_digit:
+udiv x4, x0, x2
+msub x5, x4, x2, x0
+add x5, x5, #48
+sub x1, x1, #1
+strb w5, [x1]
+add x3, x3, #1
+mov x0, x4
+cbnz x0, print_digit
+mov x0, #1
+mov x2, x3
+mov x8, #64
+svc #0
+ret
+
+// syscall_number maps the x86-64 syscall number in x8 to the arm64 one
+syscall_number:
+cmp x8, #258
+b.hs syscall_unknown
+ldr x9, =syscall_table
+ldrsh x8, [x9, x8, lsl #1]
+ret
+syscall_unknown:
+mov x8, #-1
+ret
+
+// runtime_error writes the message at x1 with length x2 to stderr and exits with x3
+runtime_error:
+mov x0, #2
+mov x8, #64
+svc #0
+mov x0, x3
+mov x8, #93
+svc #0
+
+.global _start
+.global vars_buffer
+_start:
+ldr x28, =data_stack_end
+ldr x27, =ret_stack_end
+main_b0:
+// -- Int Push --
+mov x0, #1
+str x0, [x28, #-8]!
+// -- Int Push --
+mov x0, #2
+str x0, [x28, #-8]!
+// -- Let --
+sub x27, x27, #16
+ldr x0, [x28], #8
+str x0, [x27, #8]
+ldr x0, [x28], #8
+str x0, [x27, #0]
+// -- Local --
+ldr x0, [x27, #0]
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- Local --
+ldr x0, [x27, #8]
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- Local --
+ldr x0, [x27, #0]
+str x0, [x28, #-8]!
+// -- Local --
+ldr x0, [x27, #8]
+str x0, [x28, #-8]!
+// -- Plus --
+ldr x1, [x28], #8
+ldr x0, [x28], #8
+add x0, x0, x1
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- LetEnd --
+add x27, x27, #16
+// -- Int Push --
+mov x0, #5
+str x0, [x28, #-8]!
+// -- Let --
+sub x27, x27, #8
+ldr x0, [x28], #8
+str x0, [x27, #0]
+// -- Int Push --
+mov x0, #0
+str x0, [x28, #-8]!
+main_b1:
+// -- Dup --
+ldr x0, [x28]
+str x0, [x28, #-8]!
+// -- Local --
+ldr x0, [x27, #0]
+str x0, [x28, #-8]!
+// -- Compare Branch --
+ldr x1, [x28], #8
+ldr x0, [x28], #8
+cmp x0, x1
+b.gt main_b3
+main_b2:
+// -- Dup --
+ldr x0, [x28]
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- Int Push --
+mov x0, #1
+str x0, [x28, #-8]!
+// -- Plus --
+ldr x1, [x28], #8
+ldr x0, [x28], #8
+add x0, x0, x1
+str x0, [x28, #-8]!
+// -- Jump --
+b main_b1
+main_b3:
+// -- Drop --
+add x28, x28, #8
+// -- LetEnd --
+add x27, x27, #8
+// -- Int Push --
+mov x0, #10
+str x0, [x28, #-8]!
+// -- Let --
+sub x27, x27, #8
+ldr x0, [x28], #8
+str x0, [x27, #0]
+// -- Int Push --
+mov x0, #20
+str x0, [x28, #-8]!
+// -- Let --
+sub x27, x27, #8
+ldr x0, [x28], #8
+str x0, [x27, #0]
+// -- Local --
+ldr x0, [x27, #8]
+str x0, [x28, #-8]!
+// -- Local --
+ldr x0, [x27, #0]
+str x0, [x28, #-8]!
+// -- Mul --
+ldr x1, [x28], #8
+ldr x0, [x28], #8
+mul x0, x0, x1
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- LetEnd --
+add x27, x27, #8
+// -- Local --
+ldr x0, [x27, #0]
+str x0, [x28, #-8]!
+// -- Print --
+ldr x0, [x28], #8
+bl print
+// -- LetEnd --
+add x27, x27, #8
+// -- Exit --
+mov x8, #93
+mov x0, #0
+svc #0
+.ltorg
+.bss
+.balign 8
+print_buffer: .skip 22
+.balign 8
+vars_buffer: .skip 0
+ret_stack: .skip 8*1024
+ret_stack_end:
+data_stack: .skip 8388608
+data_stack_end:
+.data
+.balign 2
+syscall_table:
+.hword 63, 64, -1, 57, -1, 80, -1, -1, 62, 222, -1, 215, 214, -1, -1, -1
+.hword 29, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword 23, -1, -1, 101, -1, -1, -1, 172, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 221, 93, 260, 129, 160
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, 17
+.hword 49, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword 169, -1, -1, -1, -1, -1, 174, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, 94, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1
+.hword -1, 56
@@ -0,0 +1,151 @@
+; generated by dodolang
+target triple = "x86_64-pc-linux-gnu"
+
+; top of the data stack, top of the let frames and the bases of both stacks
+%dodo.state = type { ptr, ptr, ptr, ptr }
+
+
+define internal i64 @syscall(i64 %n, i64 %a1, i64 %a2, i64 %a3) {
+  %r = call i64 asm sideeffect "syscall", "={rax},{rax},{rdi},{rsi},{rdx},~{rcx},~{r11},~{memory}"(i64 %n, i64 %a1, i64 %a2, i64 %a3)
+  ret i64 %r
+}
+
+define internal void @push(ptr %state, i64 %v) alwaysinline {
+  %top = load ptr, ptr %state
+  store i64 %v, ptr %top
+  %next = getelementptr i64, ptr %top, i64 1
+  store ptr %next, ptr %state
+  ret void
+}
+
+define internal i64 @pop(ptr %state) alwaysinline {
+  %top = load ptr, ptr %state
+  %prev = getelementptr i64, ptr %top, i64 -1
+  store ptr %prev, ptr %state
+  %v = load i64, ptr %prev
+  ret i64 %v
+}
+
+define internal void @runtime_error_if(i1 %cond, ptr %msg, i64 %len, i64 %code) alwaysinline {
+entry:
+  br i1 %cond, label %error, label %ok
+error:
+  %m = ptrtoint ptr %msg to i64
+  call i64 @syscall(i64 1, i64 2, i64 %m, i64 %len)
+  call i64 @syscall(i64 60, i64 %code, i64 0, i64 0)
+  unreachable
+ok:
+  ret void
+}
+
+define internal i1 @stack_underflows(ptr %state, i64 %n) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %need = mul i64 %n, 8
+  %under = icmp ult i64 %size, %need
+  ret i1 %under
+}
+
+define internal i1 @stack_overflows(ptr %state) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %data = icmp ugt i64 %size, 4194304
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %rp = load ptr, ptr %rp.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  %ret = load ptr, ptr %ret.field
+  %r = ptrtoint ptr %rp to i64
+  %rb = ptrtoint ptr %ret to i64
+  %room = sub i64 %r, %rb
+  ; leave room for a let frame to be pushed
+  %frames = icmp ult i64 %room, 64
+  %over = or i1 %data, %frames
+  ret i1 %over
+}
+
+; print writes v as a decimal number and a newline to stdout
+define internal void @print(i64 %v) {
+entry:
+  %buf = alloca [21 x i8]
+  %nl = getelementptr [21 x i8], ptr %buf, i64 0, i64 20
+  store i8 10, ptr %nl
+  br label %digit
+digit:
+  %i = phi i64 [ 20, %entry ], [ %i.next, %digit ]
+  %n = phi i64 [ %v, %entry ], [ %n.next, %digit ]
+  %i.next = sub i64 %i, 1
+  %r = urem i64 %n, 10
+  %r8 = trunc i64 %r to i8
+  %c = add i8 %r8, 48
+  %p = getelementptr [21 x i8], ptr %buf, i64 0, i64 %i.next
+  store i8 %c, ptr %p
+  %n.next = udiv i64 %n, 10
+  %more = icmp ne i64 %n.next, 0
+  br i1 %more, label %digit, label %done
+done:
+  %start = ptrtoint ptr %p to i64
+  %len = sub i64 21, %i.next
+  call i64 @syscall(i64 1, i64 1, i64 %start, i64 %len)
+  ret void
+}
+
+define i32 @main() {
+  %stack = alloca [528384 x i64], align 8
+  %ret_stack = alloca [1024 x i64], align 8
+  %state = alloca %dodo.state
+  %ret_stack_end = getelementptr [1024 x i64], ptr %ret_stack, i64 0, i64 1024
+  %sp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 0
+  store ptr %stack, ptr %sp.field
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  store ptr %ret_stack_end, ptr %rp.field
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  store ptr %stack, ptr %base.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  store ptr %ret_stack, ptr %ret.field
+  call void @dodo_main(ptr %state)
+  ret i32 0
+}
+
+define internal void @dodo_main(ptr %state) {
+entry:
+  br label %b0
+b0:
+  call void @push(ptr %state, i64 17)
+  call void @push(ptr %state, i64 5)
+  %t1 = call i64 @pop(ptr %state)
+  %t2 = call i64 @pop(ptr %state)
+  %t3 = udiv i64 %t2, %t1
+  %t4 = urem i64 %t2, %t1
+  call void @push(ptr %state, i64 %t3)
+  call void @push(ptr %state, i64 %t4)
+  %t5 = call i64 @pop(ptr %state)
+  call void @print(i64 %t5)
+  %t6 = call i64 @pop(ptr %state)
+  call void @print(i64 %t6)
+  call void @push(ptr %state, i64 3)
+  call void @push(ptr %state, i64 4)
+  %t7 = call i64 @pop(ptr %state)
+  %t8 = call i64 @pop(ptr %state)
+  %t9 = icmp slt i64 %t8, %t7
+  %t10 = zext i1 %t9 to i64
+  call void @push(ptr %state, i64 %t10)
+  %t11 = call i64 @pop(ptr %state)
+  %t12 = icmp ne i64 %t11, 0
+  br i1 %t12, label %b1, label %b2
+b1:
+  call void @push(ptr %state, i64 1)
+  %t13 = call i64 @pop(ptr %state)
+  call void @print(i64 %t13)
+  br label %b2
+b2:
+  ret void
+}
+
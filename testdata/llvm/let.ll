@@ -0,0 +1,261 @@
+; generated by dodolang
+target triple = "x86_64-pc-linux-gnu"
+
+; top of the data stack, top of the let frames and the bases of both stacks
+%dodo.state = type { ptr, ptr, ptr, ptr }
+
+
+define internal i64 @syscall(i64 %n, i64 %a1, i64 %a2, i64 %a3) {
+  %r = call i64 asm sideeffect "syscall", "={rax},{rax},{rdi},{rsi},{rdx},~{rcx},~{r11},~{memory}"(i64 %n, i64 %a1, i64 %a2, i64 %a3)
+  ret i64 %r
+}
+
+define internal void @push(ptr %state, i64 %v) alwaysinline {
+  %top = load ptr, ptr %state
+  store i64 %v, ptr %top
+  %next = getelementptr i64, ptr %top, i64 1
+  store ptr %next, ptr %state
+  ret void
+}
+
+define internal i64 @pop(ptr %state) alwaysinline {
+  %top = load ptr, ptr %state
+  %prev = getelementptr i64, ptr %top, i64 -1
+  store ptr %prev, ptr %state
+  %v = load i64, ptr %prev
+  ret i64 %v
+}
+
+define internal void @runtime_error_if(i1 %cond, ptr %msg, i64 %len, i64 %code) alwaysinline {
+entry:
+  br i1 %cond, label %error, label %ok
+error:
+  %m = ptrtoint ptr %msg to i64
+  call i64 @syscall(i64 1, i64 2, i64 %m, i64 %len)
+  call i64 @syscall(i64 60, i64 %code, i64 0, i64 0)
+  unreachable
+ok:
+  ret void
+}
+
+define internal i1 @stack_underflows(ptr %state, i64 %n) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %need = mul i64 %n, 8
+  %under = icmp ult i64 %size, %need
+  ret i1 %under
+}
+
+define internal i1 @stack_overflows(ptr %state) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %data = icmp ugt i64 %size, 4194304
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %rp = load ptr, ptr %rp.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  %ret = load ptr, ptr %ret.field
+  %r = ptrtoint ptr %rp to i64
+  %rb = ptrtoint ptr %ret to i64
+  %room = sub i64 %r, %rb
+  ; leave room for a let frame to be pushed
+  %frames = icmp ult i64 %room, 64
+  %over = or i1 %data, %frames
+  ret i1 %over
+}
+
+; print writes v as a decimal number and a newline to stdout
+define internal void @print(i64 %v) {
+entry:
+  %buf = alloca [21 x i8]
+  %nl = getelementptr [21 x i8], ptr %buf, i64 0, i64 20
+  store i8 10, ptr %nl
+  br label %digit
+digit:
+  %i = phi i64 [ 20, %entry ], [ %i.next, %digit ]
+  %n = phi i64 [ %v, %entry ], [ %n.next, %digit ]
+  %i.next = sub i64 %i, 1
+  %r = urem i64 %n, 10
+  %r8 = trunc i64 %r to i8
+  %c = add i8 %r8, 48
+  %p = getelementptr [21 x i8], ptr %buf, i64 0, i64 %i.next
+  store i8 %c, ptr %p
+  %n.next = udiv i64 %n, 10
+  %more = icmp ne i64 %n.next, 0
+  br i1 %more, label %digit, label %done
+done:
+  %start = ptrtoint ptr %p to i64
+  %len = sub i64 21, %i.next
+  call i64 @syscall(i64 1, i64 1, i64 %start, i64 %len)
+  ret void
+}
+
+define i32 @main() {
+  %stack = alloca [528384 x i64], align 8
+  %ret_stack = alloca [1024 x i64], align 8
+  %state = alloca %dodo.state
+  %ret_stack_end = getelementptr [1024 x i64], ptr %ret_stack, i64 0, i64 1024
+  %sp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 0
+  store ptr %stack, ptr %sp.field
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  store ptr %ret_stack_end, ptr %rp.field
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  store ptr %stack, ptr %base.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  store ptr %ret_stack, ptr %ret.field
+  call void @dodo_main(ptr %state)
+  ret i32 0
+}
+
+define internal void @dodo_main(ptr %state) {
+entry:
+  br label %b0
+b0:
+  call void @push(ptr %state, i64 1)
+  call void @push(ptr %state, i64 2)
+  %t1 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t2 = load ptr, ptr %t1
+  %t3 = getelementptr i64, ptr %t2, i64 -2
+  store ptr %t3, ptr %t1
+  %t4 = call i64 @pop(ptr %state)
+  %t5 = getelementptr i64, ptr %t3, i64 1
+  store i64 %t4, ptr %t5
+  %t6 = call i64 @pop(ptr %state)
+  %t7 = getelementptr i64, ptr %t3, i64 0
+  store i64 %t6, ptr %t7
+  %t8 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t9 = load ptr, ptr %t8
+  %t10 = getelementptr i64, ptr %t9, i64 0
+  %t11 = load i64, ptr %t10
+  call void @push(ptr %state, i64 %t11)
+  %t12 = call i64 @pop(ptr %state)
+  call void @print(i64 %t12)
+  %t13 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t14 = load ptr, ptr %t13
+  %t15 = getelementptr i64, ptr %t14, i64 1
+  %t16 = load i64, ptr %t15
+  call void @push(ptr %state, i64 %t16)
+  %t17 = call i64 @pop(ptr %state)
+  call void @print(i64 %t17)
+  %t18 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t19 = load ptr, ptr %t18
+  %t20 = getelementptr i64, ptr %t19, i64 0
+  %t21 = load i64, ptr %t20
+  call void @push(ptr %state, i64 %t21)
+  %t22 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t23 = load ptr, ptr %t22
+  %t24 = getelementptr i64, ptr %t23, i64 1
+  %t25 = load i64, ptr %t24
+  call void @push(ptr %state, i64 %t25)
+  %t26 = call i64 @pop(ptr %state)
+  %t27 = call i64 @pop(ptr %state)
+  %t28 = add i64 %t27, %t26
+  call void @push(ptr %state, i64 %t28)
+  %t29 = call i64 @pop(ptr %state)
+  call void @print(i64 %t29)
+  %t30 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t31 = load ptr, ptr %t30
+  %t32 = getelementptr i64, ptr %t31, i64 2
+  store ptr %t32, ptr %t30
+  call void @push(ptr %state, i64 5)
+  %t33 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t34 = load ptr, ptr %t33
+  %t35 = getelementptr i64, ptr %t34, i64 -1
+  store ptr %t35, ptr %t33
+  %t36 = call i64 @pop(ptr %state)
+  %t37 = getelementptr i64, ptr %t35, i64 0
+  store i64 %t36, ptr %t37
+  call void @push(ptr %state, i64 0)
+  br label %b1
+b1:
+  %t38 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t38)
+  call void @push(ptr %state, i64 %t38)
+  %t39 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t40 = load ptr, ptr %t39
+  %t41 = getelementptr i64, ptr %t40, i64 0
+  %t42 = load i64, ptr %t41
+  call void @push(ptr %state, i64 %t42)
+  %t43 = call i64 @pop(ptr %state)
+  %t44 = call i64 @pop(ptr %state)
+  %t45 = icmp sle i64 %t44, %t43
+  %t46 = zext i1 %t45 to i64
+  call void @push(ptr %state, i64 %t46)
+  %t47 = call i64 @pop(ptr %state)
+  %t48 = icmp ne i64 %t47, 0
+  br i1 %t48, label %b2, label %b3
+b2:
+  %t49 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t49)
+  call void @push(ptr %state, i64 %t49)
+  %t50 = call i64 @pop(ptr %state)
+  call void @print(i64 %t50)
+  call void @push(ptr %state, i64 1)
+  %t51 = call i64 @pop(ptr %state)
+  %t52 = call i64 @pop(ptr %state)
+  %t53 = add i64 %t52, %t51
+  call void @push(ptr %state, i64 %t53)
+  br label %b1
+b3:
+  %t54 = call i64 @pop(ptr %state)
+  %t55 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t56 = load ptr, ptr %t55
+  %t57 = getelementptr i64, ptr %t56, i64 1
+  store ptr %t57, ptr %t55
+  call void @push(ptr %state, i64 10)
+  %t58 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t59 = load ptr, ptr %t58
+  %t60 = getelementptr i64, ptr %t59, i64 -1
+  store ptr %t60, ptr %t58
+  %t61 = call i64 @pop(ptr %state)
+  %t62 = getelementptr i64, ptr %t60, i64 0
+  store i64 %t61, ptr %t62
+  call void @push(ptr %state, i64 20)
+  %t63 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t64 = load ptr, ptr %t63
+  %t65 = getelementptr i64, ptr %t64, i64 -1
+  store ptr %t65, ptr %t63
+  %t66 = call i64 @pop(ptr %state)
+  %t67 = getelementptr i64, ptr %t65, i64 0
+  store i64 %t66, ptr %t67
+  %t68 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t69 = load ptr, ptr %t68
+  %t70 = getelementptr i64, ptr %t69, i64 1
+  %t71 = load i64, ptr %t70
+  call void @push(ptr %state, i64 %t71)
+  %t72 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t73 = load ptr, ptr %t72
+  %t74 = getelementptr i64, ptr %t73, i64 0
+  %t75 = load i64, ptr %t74
+  call void @push(ptr %state, i64 %t75)
+  %t76 = call i64 @pop(ptr %state)
+  %t77 = call i64 @pop(ptr %state)
+  %t78 = mul i64 %t77, %t76
+  call void @push(ptr %state, i64 %t78)
+  %t79 = call i64 @pop(ptr %state)
+  call void @print(i64 %t79)
+  %t80 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t81 = load ptr, ptr %t80
+  %t82 = getelementptr i64, ptr %t81, i64 1
+  store ptr %t82, ptr %t80
+  %t83 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t84 = load ptr, ptr %t83
+  %t85 = getelementptr i64, ptr %t84, i64 0
+  %t86 = load i64, ptr %t85
+  call void @push(ptr %state, i64 %t86)
+  %t87 = call i64 @pop(ptr %state)
+  call void @print(i64 %t87)
+  %t88 = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %t89 = load ptr, ptr %t88
+  %t90 = getelementptr i64, ptr %t89, i64 1
+  store ptr %t90, ptr %t88
+  ret void
+}
+
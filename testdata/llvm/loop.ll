@@ -0,0 +1,193 @@
+; generated by dodolang
+target triple = "x86_64-pc-linux-gnu"
+
+; top of the data stack, top of the let frames and the bases of both stacks
+%dodo.state = type { ptr, ptr, ptr, ptr }
+
+@vars_buffer = internal global [8 x i8] zeroinitializer, align 8
+
+define internal i64 @syscall(i64 %n, i64 %a1, i64 %a2, i64 %a3) {
+  %r = call i64 asm sideeffect "syscall", "={rax},{rax},{rdi},{rsi},{rdx},~{rcx},~{r11},~{memory}"(i64 %n, i64 %a1, i64 %a2, i64 %a3)
+  ret i64 %r
+}
+
+define internal void @push(ptr %state, i64 %v) alwaysinline {
+  %top = load ptr, ptr %state
+  store i64 %v, ptr %top
+  %next = getelementptr i64, ptr %top, i64 1
+  store ptr %next, ptr %state
+  ret void
+}
+
+define internal i64 @pop(ptr %state) alwaysinline {
+  %top = load ptr, ptr %state
+  %prev = getelementptr i64, ptr %top, i64 -1
+  store ptr %prev, ptr %state
+  %v = load i64, ptr %prev
+  ret i64 %v
+}
+
+define internal void @runtime_error_if(i1 %cond, ptr %msg, i64 %len, i64 %code) alwaysinline {
+entry:
+  br i1 %cond, label %error, label %ok
+error:
+  %m = ptrtoint ptr %msg to i64
+  call i64 @syscall(i64 1, i64 2, i64 %m, i64 %len)
+  call i64 @syscall(i64 60, i64 %code, i64 0, i64 0)
+  unreachable
+ok:
+  ret void
+}
+
+define internal i1 @stack_underflows(ptr %state, i64 %n) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %need = mul i64 %n, 8
+  %under = icmp ult i64 %size, %need
+  ret i1 %under
+}
+
+define internal i1 @stack_overflows(ptr %state) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %data = icmp ugt i64 %size, 4194304
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %rp = load ptr, ptr %rp.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  %ret = load ptr, ptr %ret.field
+  %r = ptrtoint ptr %rp to i64
+  %rb = ptrtoint ptr %ret to i64
+  %room = sub i64 %r, %rb
+  ; leave room for a let frame to be pushed
+  %frames = icmp ult i64 %room, 64
+  %over = or i1 %data, %frames
+  ret i1 %over
+}
+
+; print writes v as a decimal number and a newline to stdout
+define internal void @print(i64 %v) {
+entry:
+  %buf = alloca [21 x i8]
+  %nl = getelementptr [21 x i8], ptr %buf, i64 0, i64 20
+  store i8 10, ptr %nl
+  br label %digit
+digit:
+  %i = phi i64 [ 20, %entry ], [ %i.next, %digit ]
+  %n = phi i64 [ %v, %entry ], [ %n.next, %digit ]
+  %i.next = sub i64 %i, 1
+  %r = urem i64 %n, 10
+  %r8 = trunc i64 %r to i8
+  %c = add i8 %r8, 48
+  %p = getelementptr [21 x i8], ptr %buf, i64 0, i64 %i.next
+  store i8 %c, ptr %p
+  %n.next = udiv i64 %n, 10
+  %more = icmp ne i64 %n.next, 0
+  br i1 %more, label %digit, label %done
+done:
+  %start = ptrtoint ptr %p to i64
+  %len = sub i64 21, %i.next
+  call i64 @syscall(i64 1, i64 1, i64 %start, i64 %len)
+  ret void
+}
+
+define i32 @main() {
+  %stack = alloca [528384 x i64], align 8
+  %ret_stack = alloca [1024 x i64], align 8
+  %state = alloca %dodo.state
+  %ret_stack_end = getelementptr [1024 x i64], ptr %ret_stack, i64 0, i64 1024
+  %sp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 0
+  store ptr %stack, ptr %sp.field
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  store ptr %ret_stack_end, ptr %rp.field
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  store ptr %stack, ptr %base.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  store ptr %ret_stack, ptr %ret.field
+  call void @dodo_main(ptr %state)
+  ret i32 0
+}
+
+define internal void @dodo_main(ptr %state) {
+entry:
+  br label %b0
+b0:
+  %t1 = getelementptr i8, ptr @vars_buffer, i64 0
+  %t2 = ptrtoint ptr %t1 to i64
+  call void @push(ptr %state, i64 %t2)
+  call void @push(ptr %state, i64 0)
+  %t3 = call i64 @pop(ptr %state)
+  %t4 = call i64 @pop(ptr %state)
+  %t5 = inttoptr i64 %t4 to ptr
+  store i64 %t3, ptr %t5
+  br label %b1
+b1:
+  call void @push(ptr %state, i64 1)
+  %t6 = call i64 @pop(ptr %state)
+  %t7 = icmp ne i64 %t6, 0
+  br i1 %t7, label %b2, label %b5
+b2:
+  %t8 = getelementptr i8, ptr @vars_buffer, i64 0
+  %t9 = ptrtoint ptr %t8 to i64
+  call void @push(ptr %state, i64 %t9)
+  %t10 = call i64 @pop(ptr %state)
+  %t11 = inttoptr i64 %t10 to ptr
+  %t12 = load i64, ptr %t11
+  call void @push(ptr %state, i64 %t12)
+  call void @push(ptr %state, i64 10)
+  %t13 = call i64 @pop(ptr %state)
+  %t14 = call i64 @pop(ptr %state)
+  %t15 = icmp sgt i64 %t14, %t13
+  %t16 = zext i1 %t15 to i64
+  call void @push(ptr %state, i64 %t16)
+  %t17 = call i64 @pop(ptr %state)
+  %t18 = icmp ne i64 %t17, 0
+  br i1 %t18, label %b3, label %b4
+b3:
+  call void @push(ptr %state, i64 0)
+  call void @push(ptr %state, i64 60)
+  %t19 = call i64 @pop(ptr %state)
+  %t20 = call i64 @pop(ptr %state)
+  call i64 @syscall(i64 %t19, i64 %t20, i64 0, i64 0)
+  br label %b4
+b4:
+  %t21 = getelementptr i8, ptr @vars_buffer, i64 0
+  %t22 = ptrtoint ptr %t21 to i64
+  call void @push(ptr %state, i64 %t22)
+  %t23 = getelementptr i8, ptr @vars_buffer, i64 0
+  %t24 = ptrtoint ptr %t23 to i64
+  call void @push(ptr %state, i64 %t24)
+  %t25 = call i64 @pop(ptr %state)
+  %t26 = inttoptr i64 %t25 to ptr
+  %t27 = load i64, ptr %t26
+  call void @push(ptr %state, i64 %t27)
+  call void @push(ptr %state, i64 1)
+  %t28 = call i64 @pop(ptr %state)
+  %t29 = call i64 @pop(ptr %state)
+  %t30 = add i64 %t29, %t28
+  call void @push(ptr %state, i64 %t30)
+  %t31 = call i64 @pop(ptr %state)
+  %t32 = call i64 @pop(ptr %state)
+  %t33 = inttoptr i64 %t32 to ptr
+  store i64 %t31, ptr %t33
+  %t34 = getelementptr i8, ptr @vars_buffer, i64 0
+  %t35 = ptrtoint ptr %t34 to i64
+  call void @push(ptr %state, i64 %t35)
+  %t36 = call i64 @pop(ptr %state)
+  %t37 = inttoptr i64 %t36 to ptr
+  %t38 = load i64, ptr %t37
+  call void @push(ptr %state, i64 %t38)
+  %t39 = call i64 @pop(ptr %state)
+  call void @print(i64 %t39)
+  br label %b1
+b5:
+  ret void
+}
+
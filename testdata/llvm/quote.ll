@@ -0,0 +1,215 @@
+; generated by dodolang
+target triple = "x86_64-pc-linux-gnu"
+
+; top of the data stack, top of the let frames and the bases of both stacks
+%dodo.state = type { ptr, ptr, ptr, ptr }
+
+
+define internal i64 @syscall(i64 %n, i64 %a1, i64 %a2, i64 %a3) {
+  %r = call i64 asm sideeffect "syscall", "={rax},{rax},{rdi},{rsi},{rdx},~{rcx},~{r11},~{memory}"(i64 %n, i64 %a1, i64 %a2, i64 %a3)
+  ret i64 %r
+}
+
+define internal void @push(ptr %state, i64 %v) alwaysinline {
+  %top = load ptr, ptr %state
+  store i64 %v, ptr %top
+  %next = getelementptr i64, ptr %top, i64 1
+  store ptr %next, ptr %state
+  ret void
+}
+
+define internal i64 @pop(ptr %state) alwaysinline {
+  %top = load ptr, ptr %state
+  %prev = getelementptr i64, ptr %top, i64 -1
+  store ptr %prev, ptr %state
+  %v = load i64, ptr %prev
+  ret i64 %v
+}
+
+define internal void @runtime_error_if(i1 %cond, ptr %msg, i64 %len, i64 %code) alwaysinline {
+entry:
+  br i1 %cond, label %error, label %ok
+error:
+  %m = ptrtoint ptr %msg to i64
+  call i64 @syscall(i64 1, i64 2, i64 %m, i64 %len)
+  call i64 @syscall(i64 60, i64 %code, i64 0, i64 0)
+  unreachable
+ok:
+  ret void
+}
+
+define internal i1 @stack_underflows(ptr %state, i64 %n) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %need = mul i64 %n, 8
+  %under = icmp ult i64 %size, %need
+  ret i1 %under
+}
+
+define internal i1 @stack_overflows(ptr %state) {
+  %top = load ptr, ptr %state
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  %base = load ptr, ptr %base.field
+  %t = ptrtoint ptr %top to i64
+  %b = ptrtoint ptr %base to i64
+  %size = sub i64 %t, %b
+  %data = icmp ugt i64 %size, 4194304
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  %rp = load ptr, ptr %rp.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  %ret = load ptr, ptr %ret.field
+  %r = ptrtoint ptr %rp to i64
+  %rb = ptrtoint ptr %ret to i64
+  %room = sub i64 %r, %rb
+  ; leave room for a let frame to be pushed
+  %frames = icmp ult i64 %room, 64
+  %over = or i1 %data, %frames
+  ret i1 %over
+}
+
+; print writes v as a decimal number and a newline to stdout
+define internal void @print(i64 %v) {
+entry:
+  %buf = alloca [21 x i8]
+  %nl = getelementptr [21 x i8], ptr %buf, i64 0, i64 20
+  store i8 10, ptr %nl
+  br label %digit
+digit:
+  %i = phi i64 [ 20, %entry ], [ %i.next, %digit ]
+  %n = phi i64 [ %v, %entry ], [ %n.next, %digit ]
+  %i.next = sub i64 %i, 1
+  %r = urem i64 %n, 10
+  %r8 = trunc i64 %r to i8
+  %c = add i8 %r8, 48
+  %p = getelementptr [21 x i8], ptr %buf, i64 0, i64 %i.next
+  store i8 %c, ptr %p
+  %n.next = udiv i64 %n, 10
+  %more = icmp ne i64 %n.next, 0
+  br i1 %more, label %digit, label %done
+done:
+  %start = ptrtoint ptr %p to i64
+  %len = sub i64 21, %i.next
+  call i64 @syscall(i64 1, i64 1, i64 %start, i64 %len)
+  ret void
+}
+
+define i32 @main() {
+  %stack = alloca [528384 x i64], align 8
+  %ret_stack = alloca [1024 x i64], align 8
+  %state = alloca %dodo.state
+  %ret_stack_end = getelementptr [1024 x i64], ptr %ret_stack, i64 0, i64 1024
+  %sp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 0
+  store ptr %stack, ptr %sp.field
+  %rp.field = getelementptr %dodo.state, ptr %state, i32 0, i32 1
+  store ptr %ret_stack_end, ptr %rp.field
+  %base.field = getelementptr %dodo.state, ptr %state, i32 0, i32 2
+  store ptr %stack, ptr %base.field
+  %ret.field = getelementptr %dodo.state, ptr %state, i32 0, i32 3
+  store ptr %ret_stack, ptr %ret.field
+  call void @dodo_main(ptr %state)
+  ret i32 0
+}
+
+define internal void @dodo_main(ptr %state) {
+entry:
+  br label %b0
+b0:
+  %t1 = ptrtoint ptr @dodo_quote_0 to i64
+  call void @push(ptr %state, i64 %t1)
+  %t2 = call i64 @pop(ptr %state)
+  %t3 = inttoptr i64 %t2 to ptr
+  call void %t3(ptr %state)
+  call void @push(ptr %state, i64 5)
+  %t4 = ptrtoint ptr @dodo_quote_1 to i64
+  call void @push(ptr %state, i64 %t4)
+  %t5 = call i64 @pop(ptr %state)
+  %t6 = inttoptr i64 %t5 to ptr
+  call void %t6(ptr %state)
+  %t7 = call i64 @pop(ptr %state)
+  call void @print(i64 %t7)
+  call void @push(ptr %state, i64 3)
+  %t8 = ptrtoint ptr @dodo_quote_2 to i64
+  call void @push(ptr %state, i64 %t8)
+  %t9 = call i64 @pop(ptr %state)
+  %t10 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t9)
+  call void @push(ptr %state, i64 %t10)
+  br label %b1
+b1:
+  %t11 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t11)
+  call void @push(ptr %state, i64 %t11)
+  call void @push(ptr %state, i64 0)
+  %t12 = call i64 @pop(ptr %state)
+  %t13 = call i64 @pop(ptr %state)
+  %t14 = icmp sgt i64 %t13, %t12
+  %t15 = zext i1 %t14 to i64
+  call void @push(ptr %state, i64 %t15)
+  %t16 = call i64 @pop(ptr %state)
+  %t17 = icmp ne i64 %t16, 0
+  br i1 %t17, label %b2, label %b3
+b2:
+  %t18 = call i64 @pop(ptr %state)
+  %t19 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t18)
+  call void @push(ptr %state, i64 %t19)
+  %t20 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t20)
+  call void @push(ptr %state, i64 %t20)
+  %t21 = call i64 @pop(ptr %state)
+  %t22 = inttoptr i64 %t21 to ptr
+  call void %t22(ptr %state)
+  %t23 = call i64 @pop(ptr %state)
+  %t24 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t23)
+  call void @push(ptr %state, i64 %t24)
+  call void @push(ptr %state, i64 1)
+  %t25 = call i64 @pop(ptr %state)
+  %t26 = call i64 @pop(ptr %state)
+  %t27 = sub i64 %t26, %t25
+  call void @push(ptr %state, i64 %t27)
+  br label %b1
+b3:
+  %t28 = call i64 @pop(ptr %state)
+  %t29 = call i64 @pop(ptr %state)
+  ret void
+}
+
+define internal void @dodo_quote_0(ptr %state) {
+entry:
+  br label %b0
+b0:
+  call void @push(ptr %state, i64 42)
+  %t1 = call i64 @pop(ptr %state)
+  call void @print(i64 %t1)
+  ret void
+}
+
+define internal void @dodo_quote_1(ptr %state) {
+entry:
+  br label %b0
+b0:
+  %t1 = call i64 @pop(ptr %state)
+  call void @push(ptr %state, i64 %t1)
+  call void @push(ptr %state, i64 %t1)
+  %t2 = call i64 @pop(ptr %state)
+  %t3 = call i64 @pop(ptr %state)
+  %t4 = mul i64 %t3, %t2
+  call void @push(ptr %state, i64 %t4)
+  ret void
+}
+
+define internal void @dodo_quote_2(ptr %state) {
+entry:
+  br label %b0
+b0:
+  call void @push(ptr %state, i64 7)
+  %t1 = call i64 @pop(ptr %state)
+  call void @print(i64 %t1)
+  ret void
+}
+
@@ -0,0 +1,224 @@
+;; generated by dodolang
+(module
+(import "wasi_snapshot_preview1" "fd_write" (func $fd_write (param i32 i32 i32 i32) (result i32)))
+(import "wasi_snapshot_preview1" "proc_exit" (func $proc_exit (param i32)))
+(type $routine (func))
+(memory (export "memory") 129)
+(global $sp (mut i32) (i32.const 8396872))
+(global $rp (mut i32) (i32.const 8264))
+(export "_start" (func $_start))
+
+(func $push (param $v i64)
+global.get $sp
+i32.const 8
+i32.sub
+global.set $sp
+global.get $sp
+local.get $v
+i64.store
+)
+
+(func $pop (result i64)
+global.get $sp
+i64.load
+global.get $sp
+i32.const 8
+i32.add
+global.set $sp
+)
+
+(func $write (param $fd i32) (param $ptr i32) (param $len i32)
+i32.const 0
+local.get $ptr
+i32.store
+i32.const 4
+local.get $len
+i32.store
+local.get $fd
+i32.const 0
+i32.const 1
+i32.const 8
+call $fd_write
+drop
+)
+
+;; print writes v as a decimal number and a newline to stdout
+(func $print (param $v i64) (local $p i32)
+i32.const 37
+local.tee $p
+i32.const 10
+i32.store8
+loop $digit
+local.get $p
+i32.const 1
+i32.sub
+local.tee $p
+local.get $v
+i64.const 10
+i64.rem_u
+i64.const 48
+i64.add
+i64.store8
+local.get $v
+i64.const 10
+i64.div_u
+local.tee $v
+i64.const 0
+i64.ne
+br_if $digit
+end
+i32.const 1
+local.get $p
+i32.const 38
+local.get $p
+i32.sub
+call $write
+)
+
+(func $runtime_error (param $msg i32) (param $len i32) (param $code i32)
+i32.const 2
+local.get $msg
+local.get $len
+call $write
+local.get $code
+call $proc_exit
+)
+
+;; syscall supports the x86-64 write and exit syscalls through WASI, others trap
+(func $syscall (param $n i64) (param $a1 i64) (param $a2 i64) (param $a3 i64)
+local.get $n
+i64.const 1
+i64.eq
+if
+local.get $a1
+i32.wrap_i64
+local.get $a2
+i32.wrap_i64
+local.get $a3
+i32.wrap_i64
+call $write
+return
+end
+local.get $n
+i64.const 60
+i64.eq
+local.get $n
+i64.const 231
+i64.eq
+i32.or
+if
+local.get $a1
+i32.wrap_i64
+call $proc_exit
+end
+unreachable
+)
+
+(func $_start
+call $main
+)
+
+(func $main (type $routine) (local $block i32) (local $a i64) (local $b i64) (local $c i64)
+loop $dispatch
+block $b5
+block $b4
+block $b3
+block $b2
+block $b1
+block $b0
+local.get $block
+br_table $b0 $b1 $b2 $b3 $b4 $b5
+end ;; -- Block 0 --
+i64.const 64
+call $push
+i64.const 0
+call $push
+call $pop
+local.set $b
+call $pop
+i32.wrap_i64
+local.get $b
+i64.store
+end ;; -- Block 1 --
+i64.const 1
+call $push
+call $pop
+i64.eqz
+if
+i32.const 5
+local.set $block
+br $dispatch
+end
+end ;; -- Block 2 --
+i64.const 64
+call $push
+call $pop
+i32.wrap_i64
+i64.load
+call $push
+i64.const 10
+call $push
+call $pop
+local.set $b
+call $pop
+local.get $b
+i64.gt_s
+i64.extend_i32_u
+call $push
+call $pop
+i64.eqz
+if
+i32.const 4
+local.set $block
+br $dispatch
+end
+end ;; -- Block 3 --
+i64.const 0
+call $push
+i64.const 60
+call $push
+call $pop
+call $pop
+i64.const 0
+i64.const 0
+call $syscall
+end ;; -- Block 4 --
+i64.const 64
+call $push
+i64.const 64
+call $push
+call $pop
+i32.wrap_i64
+i64.load
+call $push
+i64.const 1
+call $push
+call $pop
+local.set $b
+call $pop
+local.get $b
+i64.add
+call $push
+call $pop
+local.set $b
+call $pop
+i32.wrap_i64
+local.get $b
+i64.store
+i64.const 64
+call $push
+call $pop
+i32.wrap_i64
+i64.load
+call $push
+call $pop
+call $print
+i32.const 1
+local.set $block
+br $dispatch
+end ;; -- Block 5 --
+return
+end
+)
+
+)
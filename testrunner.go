@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siiickok/dodolang/compiler"
+)
+
+// testTimeout is how long a program of the `test` subcommand may run
+const testTimeout = 10 * time.Second
+
+const (
+	// a comment holding a line of the expected stdout
+	expectPrefix = "// expect:"
+	// a comment holding the expected exit code, which is 0 by default
+	expectExitPrefix = "// expect-exit:"
+	// the first line of a `.expected` file with the expected exit code
+	exitPrefix = "exit:"
+)
+
+// testCase is a program of the `test` subcommand along with what it is
+// expected to write to stdout and to exit with
+type testCase struct {
+	path string
+	// the expectation comes from `// expect:` comments instead of a `.expected` file
+	comments bool
+	found    bool
+	stdout   string
+	exitCode int
+}
+
+type testResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+	// the program could not be built or run, it holds the diagnostics
+	err error
+}
+
+func (r testResult) passed(tc testCase) bool {
+	return r.err == nil && tc.found && r.stdout == tc.stdout && r.exitCode == tc.exitCode
+}
+
+func expectedPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".expected"
+}
+
+// readTestCase reads the expectation of the program at path from the
+// `.expected` file next to it, or from its `// expect:` comments
+func readTestCase(path string) (testCase, error) {
+	tc := testCase{path: path}
+	if content, err := os.ReadFile(expectedPath(path)); err == nil {
+		tc.found = true
+		tc.stdout = string(content)
+		if first, rest, _ := strings.Cut(tc.stdout, "\n"); strings.HasPrefix(first, exitPrefix) {
+			tc.exitCode, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(first, exitPrefix)))
+			if err != nil {
+				return tc, fmt.Errorf("%v:1: invalid exit code `%v`", expectedPath(path), first)
+			}
+			tc.stdout = rest
+		}
+		return tc, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return tc, err
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return tc, err
+	}
+	var stdout strings.Builder
+	for i, line := range strings.Split(string(source), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, expectExitPrefix):
+			tc.found, tc.comments = true, true
+			tc.exitCode, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, expectExitPrefix)))
+			if err != nil {
+				return tc, fmt.Errorf("%v:%v: invalid exit code `%v`", path, i+1, line)
+			}
+		case strings.HasPrefix(line, expectPrefix):
+			tc.found, tc.comments = true, true
+			stdout.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, expectPrefix), " ") + "\n")
+		}
+	}
+	tc.stdout = stdout.String()
+	return tc, nil
+}
+
+// updateTestCase rewrites the expectation of tc with the output of r, in
+// the comments when it came from them and in a `.expected` file otherwise.
+// Comments can only hold whole lines, so output that does not end with a
+// newline moves the expectation into a `.expected` file
+func updateTestCase(tc testCase, r testResult) error {
+	partial := r.stdout != "" && !strings.HasSuffix(r.stdout, "\n")
+	if tc.comments && partial {
+		if err := writeExpectComments(tc.path, r); err != nil {
+			return err
+		}
+		tc.comments = false
+	}
+	if !tc.comments {
+		content := r.stdout
+		if r.exitCode != 0 {
+			content = fmt.Sprintf("%v %v\n", exitPrefix, r.exitCode) + content
+		}
+		return os.WriteFile(expectedPath(tc.path), []byte(content), 0644)
+	}
+	return writeExpectComments(tc.path, r)
+}
+
+// writeExpectComments replaces the `// expect:` comments of the program at
+// path with the output of r, the comments are only removed when the output
+// does not end with a newline
+func writeExpectComments(path string, r testResult) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(source), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, expectPrefix) && !strings.HasPrefix(trimmed, expectExitPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if r.stdout == "" || strings.HasSuffix(r.stdout, "\n") {
+		lines = append(lines, "")
+		for _, line := range strings.SplitAfter(r.stdout, "\n") {
+			if line != "" {
+				lines = append(lines, expectPrefix+" "+strings.TrimSuffix(line, "\n"))
+			}
+		}
+		// a program without output still needs a comment to be found again
+		if r.exitCode != 0 || r.stdout == "" {
+			lines = append(lines, fmt.Sprintf("%v %v", expectExitPrefix, r.exitCode))
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// findTestCases returns the programs under paths, the programs found in a
+// directory are only tested when they have an expectation or when update is
+// set, the ones named explicitly always are
+func findTestCases(paths []string, update bool) ([]testCase, error) {
+	var cases []testCase
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			tc, err := readTestCase(root)
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, tc)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".dodo" {
+				return err
+			}
+			tc, err := readTestCase(path)
+			if err == nil && (tc.found || update) {
+				cases = append(cases, tc)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cases, nil
+}
+
+// runTestCase builds the program of tc into dir with the built-in
+// assembler and runs it
+func runTestCase(tc testCase, opts compiler.Options, dir string, id int) testResult {
+	source, err := os.ReadFile(tc.path)
+	if err != nil {
+		return testResult{err: err}
+	}
+	opts.FilePath = tc.path
+	result, diags := compiler.Compile(string(source), opts)
+	if compiler.HasErrors(diags) {
+		var report strings.Builder
+		compiler.WriteDiagnostics(&report, diags, tc.path, string(source), false)
+		return testResult{err: errors.New(strings.TrimRight(report.String(), "\n"))}
+	}
+	exe, err := compiler.Assemble(result.Code)
+	if err != nil {
+		return testResult{err: err}
+	}
+	exePath := filepath.Join(dir, fmt.Sprintf("%v_%v", id, strings.TrimSuffix(filepath.Base(tc.path), ".dodo")))
+	if err := os.WriteFile(exePath, exe, 0755); err != nil {
+		return testResult{err: err}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exePath)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	r := testResult{stdout: stdout.String(), stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		r.err = fmt.Errorf("did not finish in %v", testTimeout)
+	case errors.As(err, &exitErr):
+		r.exitCode = exitErr.ExitCode()
+	case err != nil:
+		r.err = err
+	}
+	return r
+}
+
+// diffLines returns the lines of want and got, prefixed with `-` when they
+// are only in want, with `+` when they are only in got and with a space
+// when they are in both
+func diffLines(want string, got string) []string {
+	a := strings.SplitAfter(want, "\n")
+	b := strings.SplitAfter(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var diff []string
+	line := func(prefix string, s string) {
+		if s != "" {
+			diff = append(diff, prefix+strings.TrimSuffix(s, "\n"))
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			line(" ", a[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line("-", a[i])
+			i++
+		default:
+			line("+", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		line("-", a[i])
+	}
+	for ; j < len(b); j++ {
+		line("+", b[j])
+	}
+	return diff
+}
+
+// runTests is the `test` subcommand, it builds and runs the programs
+// under the paths in args in parallel and compares their stdout and exit
+// code with the expected ones, the exit code is 1 when any of them differs
+func runTests(args []string, opts compiler.Options) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	update := flags.Bool("update", false, "rewrite the expectations with the output of the programs")
+	jobs := flags.Int("j", runtime.NumCPU(), "number of programs built and run at once")
+	flags.Parse(args)
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	cases, err := findTestCases(paths, *update)
+	if err != nil {
+		log.Fatalln("ERROR:", err)
+	}
+	dir, err := os.MkdirTemp("", "dodolang-test")
+	if err != nil {
+		log.Fatalln("ERROR:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]testResult, len(cases))
+	ids := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, *jobs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				results[id] = runTestCase(cases[id], opts, dir, id)
+			}
+		}()
+	}
+	for id := range cases {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	passed, failed, updated := 0, 0, 0
+	for id, tc := range cases {
+		r := results[id]
+		switch {
+		case r.passed(tc):
+			passed++
+			fmt.Printf("ok   %v\n", tc.path)
+		case *update && r.err == nil:
+			if err := updateTestCase(tc, r); err != nil {
+				log.Fatalln("ERROR:", err)
+			}
+			updated++
+			fmt.Printf("upd  %v\n", tc.path)
+		default:
+			failed++
+			fmt.Printf("FAIL %v\n", tc.path)
+			switch {
+			case r.err != nil:
+				fmt.Printf("    %v\n", strings.ReplaceAll(r.err.Error(), "\n", "\n    "))
+			case !tc.found:
+				fmt.Printf("    no `.expected` file or `%v` comments, pass --update to write them\n", expectPrefix)
+			default:
+				if r.exitCode != tc.exitCode {
+					fmt.Printf("    exit code %v, expected %v\n", r.exitCode, tc.exitCode)
+				}
+				if r.stdout != tc.stdout {
+					fmt.Println("    stdout differs (-expected +got):")
+					for _, line := range diffLines(tc.stdout, r.stdout) {
+						fmt.Printf("    %v\n", line)
+					}
+				}
+				if r.stderr != "" {
+					fmt.Printf("    stderr:\n    %v\n", strings.ReplaceAll(strings.TrimRight(r.stderr, "\n"), "\n", "\n    "))
+				}
+			}
+		}
+	}
+	summary := fmt.Sprintf("%v passed, %v failed", passed, failed)
+	if *update {
+		summary += fmt.Sprintf(", %v updated", updated)
+	}
+	fmt.Println(summary)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
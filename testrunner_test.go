@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		got  string
+		diff []string
+	}{
+		{"equal", "1\n2\n", "1\n2\n", []string{" 1", " 2"}},
+		{"changed line", "1\n2\n3\n", "1\n5\n3\n", []string{" 1", "-2", "+5", " 3"}},
+		{"missing line", "1\n2\n3\n", "1\n3\n", []string{" 1", "-2", " 3"}},
+		{"extra line", "1\n3\n", "1\n2\n3\n", []string{" 1", "+2", " 3"}},
+		{"no output", "1\n", "", []string{"-1"}},
+		{"missing newline", "1\n", "1", []string{"-1", "+1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffLines(test.want, test.got); !slices.Equal(got, test.diff) {
+				t.Errorf("got %q, want %q", got, test.diff)
+			}
+		})
+	}
+}
+
+// writeTestFiles writes the files of a test program into a new directory
+// and returns the path of the program
+func writeTestFiles(t *testing.T, source string, expected *string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prog.dodo")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if expected != nil {
+		if err := os.WriteFile(expectedPath(path), []byte(*expected), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestReadTestCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected *string
+		want     testCase
+		err      bool
+	}{
+		{"expected file", "1 print\n", stringPtr("1\n"), testCase{found: true, stdout: "1\n"}, false},
+		{"expected file with an exit code", "1 print\n", stringPtr("exit: 3\n1\n"), testCase{found: true, stdout: "1\n", exitCode: 3}, false},
+		{"expected file with only an exit code", "", stringPtr("exit: 3\n"), testCase{found: true, exitCode: 3}, false},
+		{"expected file without a newline", "", stringPtr("1"), testCase{found: true, stdout: "1"}, false},
+		{"invalid exit code", "", stringPtr("exit: x\n"), testCase{}, true},
+		{
+			"comments",
+			"1 print\n// expect: 1\n2 print\n  // expect: 2\n// expect-exit: 4\n",
+			nil,
+			testCase{found: true, comments: true, stdout: "1\n2\n", exitCode: 4},
+			false,
+		},
+		{"empty expected line", "// expect:\n", nil, testCase{found: true, comments: true, stdout: "\n"}, false},
+		{"invalid exit code comment", "// expect-exit: x\n", nil, testCase{}, true},
+		{"expected file before comments", "// expect: 2\n", stringPtr("1\n"), testCase{found: true, stdout: "1\n"}, false},
+		{"no expectation", "1 print\n", nil, testCase{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestFiles(t, test.source, test.expected)
+			tc, err := readTestCase(path)
+			if test.err {
+				if err == nil {
+					t.Errorf("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.want.path = path
+			if tc != test.want {
+				t.Errorf("got %+v, want %+v", tc, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTestCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected *string
+		result   testResult
+		// the source and the `.expected` file after the update, nil when there is none
+		wantSource   string
+		wantExpected *string
+	}{
+		{
+			"comments",
+			"1 print\n// expect: 2\n\n",
+			nil,
+			testResult{stdout: "1\n"},
+			"1 print\n\n// expect: 1\n",
+			nil,
+		},
+		{
+			"comments with an exit code",
+			"// expect: 2\n0 3 syscall1\n// expect-exit: 0\n",
+			nil,
+			testResult{stdout: "1\n", exitCode: 3},
+			"0 3 syscall1\n\n// expect: 1\n// expect-exit: 3\n",
+			nil,
+		},
+		{
+			"comments without output",
+			"// expect: 2\n",
+			nil,
+			testResult{},
+			"\n// expect-exit: 0\n",
+			nil,
+		},
+		{
+			// comments only hold whole lines
+			"partial line",
+			"1 print\n// expect: 1\n",
+			nil,
+			testResult{stdout: "1\n2"},
+			"1 print\n",
+			stringPtr("1\n2"),
+		},
+		{
+			"expected file",
+			"1 print\n",
+			stringPtr("2\n"),
+			testResult{stdout: "1\n"},
+			"1 print\n",
+			stringPtr("1\n"),
+		},
+		{
+			"expected file with an exit code",
+			"1 print\n",
+			stringPtr("1\n"),
+			testResult{stdout: "1\n", exitCode: 3},
+			"1 print\n",
+			stringPtr("exit: 3\n1\n"),
+		},
+		{
+			"no expectation",
+			"1 print\n",
+			nil,
+			testResult{stdout: "1\n"},
+			"1 print\n",
+			stringPtr("1\n"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestFiles(t, test.source, test.expected)
+			tc, err := readTestCase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := updateTestCase(tc, test.result); err != nil {
+				t.Fatal(err)
+			}
+			source, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(source) != test.wantSource {
+				t.Errorf("got source %q, want %q", source, test.wantSource)
+			}
+			expected, err := os.ReadFile(expectedPath(path))
+			switch {
+			case test.wantExpected == nil && err == nil:
+				t.Errorf("got an unexpected `.expected` file %q", expected)
+			case test.wantExpected != nil && string(expected) != *test.wantExpected:
+				t.Errorf("got `.expected` file %q, want %q", expected, *test.wantExpected)
+			}
+			// the updated expectation is read back as the result
+			tc, err = readTestCase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.result.passed(tc) {
+				t.Errorf("the updated expectation %+v does not match %+v", tc, test.result)
+			}
+		})
+	}
+}